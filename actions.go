@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	_ "embed"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"go.riyazali.net/bhav/pipeline"
+	"os"
+	"time"
+)
+
+//go:embed queries/upsert_corporate_action.sql
+var upsertCorporateAction string // query to insert / update data in "corporate_action" table
+
+//go:embed queries/close_before_date.sql
+var closeBeforeDate string // query to fetch last close price of a ticker before a date
+
+// importCorporateActions records the given actions in "corporate_action" table
+func importCorporateActions(c *sqlite.Conn, actions []pipeline.CorporateAction) (n int, err error) {
+	var ups = c.Prep(upsertCorporateAction)
+	for _, action := range actions {
+		ups.SetText(":exchange", action.Exchange)
+		ups.SetText(":ticker", action.Ticker)
+		ups.SetText(":ex_date", action.ExDate.Format("2006-01-02"))
+		ups.SetText(":kind", action.Kind)
+		ups.SetFloat(":ratio_old", action.Old)
+		ups.SetFloat(":ratio_new", action.New)
+		ups.SetFloat(":amount", action.Amount)
+		ups.SetText(":purpose", action.Purpose)
+		if _, err = ups.Step(); err != nil {
+			return n, errors.Wrapf(err, "failed to import %s for %s", action.Kind, action.Ticker)
+		}
+		n += c.Changes()
+		_ = ups.Reset()
+	}
+	return n, nil
+}
+
+// adjustmentFactor returns the factor by which prices before the ex-date must be multiplied
+// to adjust them for the given action. It returns false if the factor cannot be computed (yet).
+func adjustmentFactor(kind string, old, new, amount float64, close func() (float64, bool)) (float64, bool) {
+	switch kind {
+	case pipeline.ActionSplit:
+		return new / old, true
+	case pipeline.ActionBonus:
+		return old / (old + new), true
+	case pipeline.ActionDividend:
+		if c, ok := close(); !ok {
+			return 0, false
+		} else if c <= amount {
+			return 1, true // doesn't make sense to adjust; possibly a bad record
+		} else {
+			return (c - amount) / c, true
+		}
+	case pipeline.ActionRights:
+		if c, ok := close(); !ok || c <= 0 {
+			return 0, false
+		} else { // theoretical ex-rights price / close before ex-date
+			return (old*c + new*amount) / (old + new) / c, true
+		}
+	}
+	return 1, true
+}
+
+// updateAdjustments computes pending adjustment factors in "corporate_action" table and
+// recomputes cumulative adjustments in "equity_adjustment" table for tickers whose actions have changed
+func updateAdjustments(c *sqlite.Conn) (err error) {
+	defer sqlitex.Save(c)(&err)
+
+	type key struct{ exchange, ticker string }
+	type action struct {
+		key
+		exDate, kind     string
+		old, new, amount float64
+	}
+
+	// compute factors for actions that don't have one
+	var pending []action
+	err = sqlitex.Exec(c, "SELECT * FROM corporate_action WHERE factor IS NULL", func(stmt *sqlite.Stmt) error {
+		pending = append(pending, action{
+			key:    key{stmt.GetText("exchange"), stmt.GetText("ticker")},
+			exDate: stmt.GetText("ex_date"), kind: stmt.GetText("kind"),
+			old: stmt.GetFloat("ratio_old"), new: stmt.GetFloat("ratio_new"), amount: stmt.GetFloat("amount"),
+		})
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch pending corporate actions")
+	}
+
+	var cls = c.Prep(closeBeforeDate)
+	for _, a := range pending {
+		var close = func() (float64, bool) {
+			defer cls.Reset()
+			cls.SetText(":exchange", a.exchange)
+			cls.SetText(":ticker", a.ticker)
+			cls.SetText(":date", a.exDate)
+			if found, _ := cls.Step(); !found {
+				return 0, false
+			}
+			return cls.GetFloat("close"), true
+		}
+
+		if factor, ok := adjustmentFactor(a.kind, a.old, a.new, a.amount, close); ok {
+			const query = "UPDATE corporate_action SET factor = ?, adjusted = 0 WHERE exchange = ? AND ticker = ? AND ex_date = ? AND kind = ?"
+			if err = sqlitex.Exec(c, query, nil, factor, a.exchange, a.ticker, a.exDate, a.kind); err != nil {
+				return errors.Wrapf(err, "failed to update factor for %s", a.ticker)
+			}
+		} else {
+			log.Debug().Str("exchange", a.exchange).Str("ticker", a.ticker).Str("kind", a.kind).
+				Msgf("unable to compute adjustment factor for %s", a.exDate)
+		}
+	}
+
+	// recompute cumulative factors for tickers whose actions have changed
+	var changed []key
+	const query = "SELECT DISTINCT exchange, ticker FROM corporate_action WHERE adjusted = 0 AND factor IS NOT NULL"
+	err = sqlitex.Exec(c, query, func(stmt *sqlite.Stmt) error {
+		changed = append(changed, key{stmt.GetText("exchange"), stmt.GetText("ticker")})
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch changed corporate actions")
+	}
+
+	for _, k := range changed {
+		// factors by ex-date, in chronological order
+		var dates []string
+		var factors = make(map[string]float64)
+
+		const query = "SELECT ex_date, factor FROM corporate_action WHERE exchange = ? AND ticker = ? AND factor IS NOT NULL ORDER BY ex_date"
+		err = sqlitex.Exec(c, query, func(stmt *sqlite.Stmt) error {
+			var d = stmt.GetText("ex_date")
+			if _, ok := factors[d]; !ok {
+				dates, factors[d] = append(dates, d), 1
+			}
+			factors[d] *= stmt.GetFloat("factor")
+			return nil
+		}, k.exchange, k.ticker)
+		if err != nil {
+			return errors.Wrapf(err, "failed to fetch corporate actions for %s", k.ticker)
+		}
+
+		if err = sqlitex.Exec(c, "DELETE FROM equity_adjustment WHERE exchange = ? AND ticker = ?", nil, k.exchange, k.ticker); err != nil {
+			return errors.Wrapf(err, "failed to delete adjustments for %s", k.ticker)
+		}
+
+		// walk backwards from the latest action; prices on / after the last ex-date are unadjusted
+		var cumulative = 1.0
+		for i := len(dates) - 1; i >= 0; i-- {
+			var from = "0000-01-01"
+			if i > 0 {
+				from = dates[i-1]
+			}
+			cumulative *= factors[dates[i]]
+
+			const query = "INSERT INTO equity_adjustment (exchange, ticker, from_date, to_date, factor) VALUES (?, ?, ?, ?, ?)"
+			if err = sqlitex.Exec(c, query, nil, k.exchange, k.ticker, from, dates[i], cumulative); err != nil {
+				return errors.Wrapf(err, "failed to record adjustment for %s", k.ticker)
+			}
+		}
+
+		const update = "UPDATE corporate_action SET adjusted = 1 WHERE exchange = ? AND ticker = ? AND factor IS NOT NULL"
+		if err = sqlitex.Exec(c, update, nil, k.exchange, k.ticker); err != nil {
+			return errors.Wrapf(err, "failed to mark corporate actions as adjusted for %s", k.ticker)
+		}
+	}
+
+	log.Debug().Int("tickers", len(changed)).Msg("recomputed price adjustments")
+	return nil
+}
+
+// corporateActions implements the `corporate-actions` command which imports corporate actions
+// published by the exchange and recomputes adjusted prices
+func corporateActions(args []string) {
+	var nse string // path to nse's corporate actions file
+
+	var flags = newFlagSet("corporate-actions")
+	flags.StringVar(&nse, "nse", "", "path to corporate actions exported from nse's website (csv)")
+	_ = flags.Parse(args)
+	configureLogging()
+
+	var err error
+	var actions []pipeline.CorporateAction
+	if nse != "" {
+		var file *os.File
+		if file, err = os.Open(nse); err != nil {
+			log.Fatal().Err(err).Msgf("failed to open %s", nse)
+		}
+
+		actions, err = pipeline.ReadNseCorporateActions(file)
+		_ = file.Close()
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to read corporate actions")
+		}
+	}
+
+	var conn = openDatabase(filename)
+	defer conn.Close()
+
+	var n int
+	var start = time.Now()
+	err = func() (err error) {
+		defer sqlitex.Save(conn)(&err) // import everything or nothing
+		n, err = importCorporateActions(conn, actions)
+		return err
+	}()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to import corporate actions")
+	}
+	log.Info().Int("count", n).Msg("imported corporate actions")
+
+	if err = updateAdjustments(conn); err != nil {
+		log.Fatal().Err(err).Msg("failed to update price adjustments")
+	}
+	log.Info().Dur("took", time.Since(start)).Msg("updated price adjustments")
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"fmt"
+	"go.riyazali.net/bhav/pipeline"
+	"go.riyazali.net/bhav/pipeline/fake"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAdjustments(t *testing.T) {
+	var conn = openDatabase(filepath.Join(t.TempDir(), "bhavcopy.db"))
+	defer conn.Close()
+
+	var script string
+	for day := 1; day <= 5; day++ {
+		script += fmt.Sprintf("INSERT INTO equity (exchange, trading_date, ticker, type, open, high, low, close) "+
+			"VALUES ('nse', '2021-03-%02d', 'INFY', 'EQ', 100, 120, 80, 110);\n", day)
+	}
+	if err := sqlitex.ExecScript(conn, script); err != nil {
+		t.Fatal(err)
+	}
+
+	// split from rs 10 to rs 2 on 3rd, and a 1:1 bonus on 5th
+	var purpose = func(p string, faceValue float64, exDate time.Time) (actions []pipeline.CorporateAction) {
+		for _, action := range pipeline.ParseCorporateActionPurpose(p, faceValue) {
+			action.Exchange, action.Ticker, action.ExDate, action.Purpose = "nse", "INFY", exDate, p
+			actions = append(actions, action)
+		}
+		return actions
+	}
+	var actions = append(
+		purpose("Face Value Split (Sub-Division) - From Rs 10/- Per Share To Rs 2/- Per Share", 10, time.Date(2021, 03, 03, 0, 0, 0, 0, time.UTC)),
+		purpose("Bonus 1:1", 2, time.Date(2021, 03, 05, 0, 0, 0, 0, time.UTC))...)
+
+	if n, err := importCorporateActions(conn, actions); err != nil || n != 2 {
+		t.Fatalf("importCorporateActions() = %d, %v; want 2 actions", n, err)
+	}
+	if err := updateAdjustments(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	// prices before the split are adjusted for both actions, prices between the two only for the bonus
+	var want = map[string]float64{"2021-03-01": 0.1, "2021-03-02": 0.1, "2021-03-03": 0.5, "2021-03-04": 0.5, "2021-03-05": 1}
+	const query = "SELECT trading_date, open, high, low, close, factor FROM equity_adjusted WHERE ticker = 'INFY' ORDER BY trading_date"
+	var rows int
+	var err = sqlitex.Exec(conn, query, func(stmt *sqlite.Stmt) error {
+		rows++
+		var date, factor = stmt.GetText("trading_date"), want[stmt.GetText("trading_date")]
+		var ohlc = [4]float64{stmt.GetFloat("open"), stmt.GetFloat("high"), stmt.GetFloat("low"), stmt.GetFloat("close")}
+		for i, price := range [4]float64{100, 120, 80, 110} {
+			if math.Abs(ohlc[i]-price*factor) > 1e-9 || math.Abs(stmt.GetFloat("factor")-factor) > 1e-9 {
+				t.Errorf("%s: got ohlc %v (factor %v); want factor %v", date, ohlc, stmt.GetFloat("factor"), factor)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if rows != len(want) {
+		t.Errorf("got %d adjusted rows; want %d", rows, len(want))
+	}
+}
+
+// TestAdjustmentsAfterSync checks that the update after a sync only recomputes adjustments for affected tickers
+func TestAdjustmentsAfterSync(t *testing.T) {
+	var server = serve(t)
+	var conn = openDatabase(filepath.Join(t.TempDir(), "bhavcopy.db"))
+	defer conn.Close()
+
+	var d = func(day int) time.Time { return time.Date(2021, 03, day, 0, 0, 0, 0, time.UTC) }
+
+	// INFY's split can be adjusted right away; TCS's dividend needs the close before ex-date, which isn't synced yet
+	var actions = []pipeline.CorporateAction{
+		{Exchange: "nse", Ticker: "INFY", ExDate: d(4), Kind: pipeline.ActionSplit, Old: 10, New: 5},
+		{Exchange: "nse", Ticker: "TCS", ExDate: d(3), Kind: pipeline.ActionDividend, Amount: 30.07},
+	}
+	if _, err := importCorporateActions(conn, actions); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateAdjustments(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, conn, "SELECT COUNT(*) FROM corporate_action WHERE factor IS NULL AND ticker = 'TCS'"); n != 1 {
+		t.Fatalf("expected TCS's dividend to be pending; got %d pending", n)
+	}
+
+	// mark INFY's adjustment; recomputing it would overwrite the mark
+	if err := sqlitex.Exec(conn, "UPDATE equity_adjustment SET factor = 0.25 WHERE ticker = 'INFY'", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for date := d(1); !date.After(d(5)); date = date.Add(day) {
+		server.AddBse(date, fake.BseReport(date))
+		server.AddNse(date, fake.NseReport(date))
+	}
+	syncDates(conn, d(1), d(5), nil)
+
+	if n := count(t, conn, "SELECT COUNT(*) FROM equity_adjustment WHERE ticker = 'INFY' AND factor = 0.25"); n != 1 {
+		t.Errorf("expected INFY's adjustment to be left untouched")
+	}
+
+	// close on 2nd is 3007; (3007 - 30.07) / 3007 = 0.99
+	var factor float64
+	var fn = func(stmt *sqlite.Stmt) error { factor = stmt.ColumnFloat(0); return nil }
+	if err := sqlitex.Exec(conn, "SELECT factor FROM equity_adjusted WHERE ticker = 'TCS' AND trading_date = '2021-03-02'", fn); err != nil {
+		t.Fatal(err)
+	} else if math.Abs(factor-0.99) > 1e-9 {
+		t.Errorf("got TCS's adjustment factor %v; want 0.99", factor)
+	}
+}
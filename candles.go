@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	_ "embed"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"strings"
+	"time"
+)
+
+//go:embed queries/aggregate_candles.sql
+var aggregateCandles string // query template to compute higher timeframe candles
+
+// timeframes maps the candle tables to the expression computing start of the period for a trading_date
+var timeframes = []struct{ table, period string }{
+	{table: "equity_weekly", period: "DATE(trading_date, 'weekday 0', '-6 days')"},
+	{table: "equity_monthly", period: "DATE(trading_date, 'start of month')"},
+	{table: "equity_yearly", period: "DATE(trading_date, 'start of year')"},
+}
+
+// updateCandles recomputes the higher timeframe candles for each exchange starting from the period
+// containing the given date. Candle tables that have no data for an exchange are computed from scratch.
+func updateCandles(c *sqlite.Conn, since map[string]time.Time) (err error) {
+	defer sqlitex.Save(c)(&err)
+
+	for _, tf := range timeframes {
+		var query = strings.NewReplacer("{{table}}", tf.table, "{{period}}", tf.period).Replace(aggregateCandles)
+
+		for _, exchange := range exchanges() {
+			var from, ok = since[exchange]
+
+			var empty = true
+			var check = "SELECT 1 FROM " + tf.table + " WHERE exchange = ? LIMIT 1"
+			if err = sqlitex.Exec(c, check, func(*sqlite.Stmt) error { empty = false; return nil }, exchange); err != nil {
+				return errors.Wrapf(err, "failed to query %s", tf.table)
+			}
+
+			if empty { // build the whole table
+				from, ok = time.Time{}, true
+			}
+
+			if !ok { // no new data for the exchange
+				continue
+			}
+
+			log.Debug().Str("exchange", exchange).Str("table", tf.table).Msgf("computing candles since %s", from.Format("2006-01-02"))
+
+			var stmt = c.Prep(query)
+			stmt.SetText(":exchange", exchange)
+			stmt.SetText(":from", from.Format("2006-01-02"))
+			if _, err = stmt.Step(); err != nil {
+				return errors.Wrapf(err, "failed to compute %s candles", tf.table)
+			}
+			_ = stmt.Reset()
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"github.com/rs/zerolog/log"
+	flag "github.com/spf13/pflag"
+	"go.riyazali.net/bhav/pipeline"
+	"os"
+)
+
+// commands are the sub-commands supported by the tool, invoked as `bhav <command> [flags]`
+// invoking the tool without a command runs the sync (the default command)
+var commands = map[string]func(args []string){
+	"refresh-masters":   refreshMasters,
+	"corporate-actions": corporateActions,
+	"sql":               sqlShell,
+	"verify":            verify,
+	"gaps":              gaps,
+	"reconcile":         reconcile,
+	"quarantine":        quarantine,
+	"migrate":           migrate,
+}
+
+// newFlagSet creates a new flag set for the named sub-command
+// with the common flags (--filename, and logging flags like --verbose) already registered
+func newFlagSet(name string) *flag.FlagSet {
+	var flags = flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage of bhav %s:\n", name)
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&filename, "filename", "bhavcopy.db", "database file to use")
+	addLogFlags(flags)
+	return flags
+}
+
+// addPipelineFlags registers flags to configure concurrency of the pipeline (see pipelineOptions) and progress reporting
+func addPipelineFlags(flags *flag.FlagSet) {
+	flags.IntVar(&pipelineOptions.Downloaders, "downloaders", pipelineOptions.Downloaders, "number of concurrent downloaders")
+	flags.IntVar(&pipelineOptions.Parsers, "parsers", pipelineOptions.Parsers, "number of concurrent parsers")
+	flags.IntVar(&pipelineOptions.BufferSize, "buffer", pipelineOptions.BufferSize, "capacity of queues between stages of the pipeline")
+	flags.StringToIntVar(&pipelineOptions.ExchangeLimits, "exchange-limit", pipelineOptions.ExchangeLimits,
+		fmt.Sprintf("maximum concurrent downloads per exchange, as exchange=limit; %d unless set", pipeline.DefaultExchangeLimit))
+	flags.Var(&reportProgress, "progress", "how to report progress: auto (bar on a terminal, log otherwise), bar, log or none")
+}
+
+// http options for requests to the exchanges (see addHttpFlags)
+var clientOptions = pipeline.DefaultClientOptions() // options for the http client
+var userAgent string                                // user agent sent by sessions with the exchanges
+var nseHeaders map[string]string                    // additional headers sent to nse
+var recordDir, replayDir string                     // directories to record responses to / replay responses from
+
+// addHttpFlags registers flags to configure requests to the exchanges
+// configureHttp() must be called after the flags are parsed
+func addHttpFlags(flags *flag.FlagSet) {
+	flags.DurationVar(&clientOptions.Timeout, "timeout", clientOptions.Timeout, "time limit for a request, including downloading the response; 0 for no limit")
+	flags.DurationVar(&clientOptions.ConnectTimeout, "connect-timeout", clientOptions.ConnectTimeout, "time limit for establishing a connection")
+	flags.StringVar(&clientOptions.Proxy, "proxy", "", "proxy url (http, https or socks5); defaults to HTTP_PROXY / HTTPS_PROXY from environment")
+	flags.StringVar(&clientOptions.CACert, "ca-cert", "", "pem file with additional certificate authorities to trust")
+	flags.DurationVar(&clientOptions.KeepAlive, "keep-alive", clientOptions.KeepAlive, "interval between tcp keep-alive probes; negative to disable")
+	flags.DurationVar(&clientOptions.IdleConnTimeout, "idle-timeout", clientOptions.IdleConnTimeout, "time an idle connection is kept open for reuse")
+	flags.BoolVar(&clientOptions.DisableKeepAlives, "no-keep-alive", false, "use a new connection for every request")
+	flags.StringVar(&userAgent, "user-agent", pipeline.DefaultUserAgent, "user agent sent to the exchanges")
+	flags.StringToStringVar(&nseHeaders, "nse-header", nil, "additional header sent with requests to nse, as name=value")
+
+	// hidden flags to record responses from the exchanges as fixtures, and to replay them later (for tests / debugging)
+	flags.StringVar(&recordDir, "record", "", "directory to record responses from the exchanges to")
+	flags.StringVar(&replayDir, "replay", "", "directory to replay recorded responses from (instead of contacting the exchanges)")
+	_ = flags.MarkHidden("record")
+	_ = flags.MarkHidden("replay")
+}
+
+// configureHttp applies the options set using flags registered by addHttpFlags
+func configureHttp() {
+	var err error
+	if pipeline.Client, err = pipeline.NewClient(clientOptions); err != nil {
+		log.Fatal().Err(err).Msg("failed to configure http client")
+	}
+
+	if replayDir != "" {
+		pipeline.Client.Transport = &pipeline.ReplayTransport{Dir: replayDir}
+	} else if recordDir != "" {
+		pipeline.Client.Transport = &pipeline.RecordingTransport{Dir: recordDir, Transport: pipeline.Client.Transport}
+	}
+
+	// sessions are shared by sources of an exchange (and pipeline.NseSession is nse/equity's); set headers once per session
+	var sessions = map[*pipeline.Session]bool{pipeline.NseSession: true}
+	for _, source := range pipeline.Sources() {
+		if source.Session != nil {
+			sessions[source.Session] = true
+		}
+	}
+	for session := range sessions {
+		session.SetHeader("User-Agent", userAgent)
+	}
+
+	for key, value := range nseHeaders {
+		pipeline.NseSession.SetHeader(key, value)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"go.riyazali.net/bhav/pipeline"
+	"testing"
+)
+
+func TestPipelineFlags(t *testing.T) {
+	defer func(opts pipeline.Options) { pipelineOptions = opts }(pipelineOptions)
+
+	var tests = []struct {
+		args   []string
+		limits map[string]int
+	}{
+		{args: nil, limits: map[string]int{}},
+		{args: []string{"--exchange-limit", "bse=3"}, limits: map[string]int{"bse": 3}},
+		{args: []string{"--exchange-limit", "bse=3,nse=1"}, limits: map[string]int{"bse": 3, "nse": 1}},
+		{args: []string{"--exchange-limit", "bse=3", "--exchange-limit", "nse=1"}, limits: map[string]int{"bse": 3, "nse": 1}},
+	}
+
+	for _, test := range tests {
+		pipelineOptions = pipeline.DefaultOptions()
+		var flags = newFlagSet("sync")
+		addPipelineFlags(flags)
+		if err := flags.Parse(test.args); err != nil {
+			t.Fatalf("%q: %v", test.args, err)
+		}
+
+		var limits = pipelineOptions.ExchangeLimits
+		if len(limits) != len(test.limits) {
+			t.Errorf("%q: got limits %v; want %v", test.args, limits, test.limits)
+		}
+		for exchange, n := range test.limits {
+			if limits[exchange] != n {
+				t.Errorf("%q: got limits %v; want %v", test.args, limits, test.limits)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	_ "embed"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"go.riyazali.net/bhav/pipeline"
+	"strings"
+	"time"
+)
+
+//go:embed queries/insert_equity.sql
+var insertIntoEquity string // query to insert data into "equity" table, skipping existing rows
+
+//go:embed queries/upsert_equity.sql
+var upsertEquity string // query to insert data into "equity" table, replacing existing rows
+
+//go:embed queries/insert_equity_revision.sql
+var insertEquityRevision string // query to record a revision to an existing row in "equity" table
+
+// modes of resolving conflicts between a record and an existing row in "equity" table (see --on-conflict)
+const (
+	onConflictSkip    = "skip"    // keep the existing row
+	onConflictReplace = "replace" // replace the existing row's values with the record's
+	onConflictAudit   = "audit"   // same as replace, but record old and new values in "equity_revision" table
+)
+
+// conflictMode implements pflag.Value for --on-conflict
+type conflictMode string
+
+func (m *conflictMode) String() string { return string(*m) }
+func (m *conflictMode) Type() string   { return "mode" }
+func (m *conflictMode) Set(s string) error {
+	switch s {
+	case onConflictSkip, onConflictReplace, onConflictAudit:
+		*m = conflictMode(s)
+		return nil
+	}
+	return fmt.Errorf("must be one of %s", strings.Join([]string{onConflictSkip, onConflictReplace, onConflictAudit}, ", "))
+}
+
+// equityWriter writes records into "equity" table, resolving conflicts with existing rows as per the mode
+type equityWriter struct {
+	mode conflictMode
+	run  int64 // id of the sync run writing the records; zero if not part of a run
+	conn *sqlite.Conn
+	ins  *sqlite.Stmt // statement to insert (or upsert) a record
+	rev  *sqlite.Stmt // statement to record a revision; nil unless auditing
+
+	inserted map[string]time.Time // earliest trading date written per exchange
+	written  int                  // number of rows inserted / updated
+	revised  int                  // number of revisions recorded
+	skipped  int                  // number of records skipped (as the existing row was kept, or it had same values)
+	failed   int                  // number of records that couldn't be written
+
+	// state of the writer when it started writing the current resource; nil between resources (see End)
+	savepoint *equityWriter
+}
+
+// newEquityWriter creates a new writer for the given sync run (see startRun); run can be nil
+func newEquityWriter(conn *sqlite.Conn, mode conflictMode, run *syncRun) *equityWriter {
+	var w = &equityWriter{mode: mode, conn: conn, inserted: make(map[string]time.Time)}
+	if run != nil {
+		w.run = run.id
+	}
+
+	switch mode {
+	case onConflictReplace:
+		w.ins = conn.Prep(upsertEquity)
+	case onConflictAudit:
+		w.ins, w.rev = conn.Prep(upsertEquity), conn.Prep(insertEquityRevision)
+	default:
+		w.ins = conn.Prep(insertIntoEquity)
+	}
+	return w
+}
+
+// write writes the record into the database
+func (w *equityWriter) write(eq pipeline.Equity) (err error) {
+	if w.rev != nil {
+		if err = bindEquity(w.rev, eq, w.run); err != nil {
+			w.failed++
+			return err
+		}
+		w.revised += w.conn.Changes()
+	}
+
+	if err = bindEquity(w.ins, eq, w.run); err != nil {
+		w.failed++
+		return err
+	}
+
+	if w.conn.Changes() == 0 {
+		w.skipped++
+		return nil
+	}
+
+	w.written++
+	if d, ok := w.inserted[eq.Exchange()]; !ok || eq.TradingDate().Before(d) {
+		w.inserted[eq.Exchange()] = eq.TradingDate()
+	}
+	return nil
+}
+
+// Write writes a batch of records, logging the records that couldn't be written. Records of a resource are written
+// in a savepoint, released (or rolled back) once the resource is done (see End). It implements pipeline.Sink.
+func (w *equityWriter) Write(eqs []pipeline.Equity) error {
+	if w.savepoint == nil {
+		if err := sqlitex.Exec(w.conn, "SAVEPOINT resource", nil); err != nil {
+			return err
+		}
+
+		var saved = *w
+		saved.inserted = make(map[string]time.Time, len(w.inserted))
+		for exchange, d := range w.inserted {
+			saved.inserted[exchange] = d
+		}
+		w.savepoint = &saved
+	}
+
+	for _, eq := range eqs {
+		if err := w.write(eq); err != nil {
+			log.Warn().Err(err).Str("exchange", eq.Exchange()).Str("date", eq.TradingDate().Format("2006-01-02")).
+				Str("ticker", eq.Ticker()).Msg("failed to insert row")
+		}
+	}
+	return nil
+}
+
+// End releases the savepoint of the resource written, or rolls it back (along with the writer's counters)
+// if the resource failed midway, so that a resource is never partially loaded. It implements pipeline.ResourceSink.
+func (w *equityWriter) End(r *pipeline.ResourceResult) error {
+	var saved = w.savepoint
+	if saved == nil {
+		return nil
+	}
+	w.savepoint = nil
+
+	if r.Err != nil {
+		log.Warn().Err(r.Err).Str("exchange", r.Resource.Exchange()).Str("date", r.Resource.Date().Format("2006-01-02")).
+			Int("discarded", w.written-saved.written).Msg("rolling back records of failed resource")
+		w.inserted, w.written, w.revised, w.skipped, w.failed = saved.inserted, saved.written, saved.revised, saved.skipped, saved.failed
+		if err := sqlitex.Exec(w.conn, "ROLLBACK TO resource", nil); err != nil {
+			return err
+		}
+	}
+	return sqlitex.Exec(w.conn, "RELEASE resource", nil)
+}
+
+// progressWriter is an equityWriter that reports the records it writes to the progress of the sync
+type progressWriter struct {
+	*equityWriter
+	progress *progress
+}
+
+func (w progressWriter) Write(eqs []pipeline.Equity) error {
+	var written = w.written
+	var err = w.equityWriter.Write(eqs)
+	if len(eqs) > 0 { // records in a batch are from the same resource (and exchange)
+		w.progress.inserted(eqs[0].Exchange(), w.written-written)
+	}
+	return err
+}
+
+// syncEquities runs the jobs through the pipeline (configured using pipelineOptions), writing the records using the
+// writer and collecting the rows that couldn't be parsed in rejected. The earliest trading date inserted (or updated)
+// for each exchange is recorded in the writer.
+func syncEquities(ctx context.Context, jobs []pipeline.Job, w *equityWriter, rejected *quarantined) (*pipeline.SyncResult, error) {
+	var progress = newProgress(jobs)
+	var opts = pipeline.SyncOptions{Options: pipelineOptions, Jobs: jobs}
+	opts.OnRowError = rejected.add
+	opts.OnResource = progress.resource
+	opts.Sink = progressWriter{equityWriter: w, progress: progress}
+
+	var stop = progress.start()
+	var result, err = pipeline.Sync(ctx, opts)
+	stop()
+	log.Info().Str("on-conflict", string(w.mode)).Int("written", w.written).Int("skipped", w.skipped).
+		Int("revised", w.revised).Int("failed", w.failed).Int("resources", result.Resources).
+		Int("failed-resources", result.Failed).Dur("duration", result.Duration).Msg("inserted records")
+	return result, err
+}
+
+// bindEquity binds the record (and the run writing it) to the parameters of the statement (see insert_equity.sql)
+// and executes it
+func bindEquity(stmt *sqlite.Stmt, eq pipeline.Equity, run int64) (err error) {
+	defer stmt.Reset()
+
+	if run != 0 {
+		stmt.SetInt64(":run_id", run)
+	} else {
+		stmt.SetNull(":run_id")
+	}
+
+	stmt.SetText(":exchange", eq.Exchange())
+	stmt.SetText(":trading_date", eq.TradingDate().Format("2006-01-02"))
+	stmt.SetText(":ticker", eq.Ticker())
+	stmt.SetText(":type", eq.Type())
+	stmt.SetText(":isin_code", eq.ISIN())
+
+	var o, h, l, c = eq.OHLC()
+	stmt.SetFloat(":open", o)
+	stmt.SetFloat(":high", h)
+	stmt.SetFloat(":low", l)
+	stmt.SetFloat(":close", c)
+
+	stmt.SetFloat(":last", eq.Last())
+	stmt.SetFloat(":previous_close", eq.PrevClose())
+	stmt.SetInt64(":volume", eq.Volume())
+
+	_, err = stmt.Step()
+	return err
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go.riyazali.net/bhav/pipeline"
+	"go.riyazali.net/bhav/pipeline/fake"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOnConflict(t *testing.T) {
+	var date = time.Date(2021, 03, 05, 0, 0, 0, 0, time.UTC)
+	var report, corrected = fake.NseReport(date), strings.Replace(fake.NseReport(date), "1310.00,1310.00,", "1311.00,1311.00,", 1)
+
+	var tests = []struct {
+		mode      conflictMode
+		close     float64 // expected close of INFY after re-sync
+		revisions int     // expected number of revisions recorded
+	}{
+		{mode: onConflictSkip, close: 1310},
+		{mode: onConflictReplace, close: 1311},
+		{mode: onConflictAudit, close: 1311, revisions: 1},
+	}
+
+	defer func(mode conflictMode) { onConflict = mode }(onConflict)
+	for _, test := range tests {
+		t.Run(string(test.mode), func(t *testing.T) {
+			var server = serve(t)
+			server.AddNse(date, report)
+
+			var conn = openDatabase(filepath.Join(t.TempDir(), "bhavcopy.db"))
+			defer conn.Close()
+
+			onConflict = test.mode
+			syncDates(conn, date, date, nil)
+
+			server.AddNse(date, corrected) // exchange re-publishes a corrected report
+			var inserted = syncDates(conn, date, date, nil)
+
+			if _, ok := inserted["nse"]; ok == (test.mode == onConflictSkip) {
+				t.Errorf("unexpected inserted dates after re-sync: %v", inserted)
+			}
+
+			if n := count(t, conn, "SELECT COUNT(*) FROM equity WHERE exchange = 'nse'"); n != 2 {
+				t.Errorf("expected 2 rows; got %d", n)
+			}
+
+			if n := count(t, conn, fmt.Sprintf("SELECT COUNT(*) FROM equity WHERE ticker = 'INFY' AND close = %v", test.close)); n != 1 {
+				t.Errorf("expected close of INFY to be %v", test.close)
+			}
+
+			var query = "SELECT COUNT(*) FROM equity_revision WHERE ticker = 'INFY' AND old_close = 1310 AND new_close = 1311 AND new_last = 1311"
+			if n := count(t, conn, query); n != test.revisions {
+				t.Errorf("expected %d revisions; got %d", test.revisions, n)
+			}
+
+			syncDates(conn, date, date, nil) // syncing the same report again must not record another revision
+			if n := count(t, conn, "SELECT COUNT(*) FROM equity_revision"); n != test.revisions {
+				t.Errorf("expected %d revisions after syncing the same report again; got %d", test.revisions, n)
+			}
+		})
+	}
+}
+
+// TestWriterRollback checks that the records of a resource that fails midway are rolled back by the writer
+func TestWriterRollback(t *testing.T) {
+	var conn = openDatabase(filepath.Join(t.TempDir(), "bhavcopy.db"))
+	defer conn.Close()
+
+	var source, _ = pipeline.Lookup("nse/equity")
+	var records = func(d time.Time) (eqs []pipeline.Equity) {
+		var err = source.Parse(strings.NewReader(fake.NseReport(d)), d, func(eq pipeline.Equity) error {
+			eqs = append(eqs, eq)
+			return nil
+		}, func(e *pipeline.RowError) error { return e })
+		if err != nil {
+			t.Fatal(err)
+		}
+		return eqs
+	}
+
+	var d1, d2 = time.Date(2021, 03, 04, 0, 0, 0, 0, time.UTC), time.Date(2021, 03, 05, 0, 0, 0, 0, time.UTC)
+	var w = newEquityWriter(conn, onConflictSkip, nil)
+
+	// the first resource is written in two batches, and released
+	var eqs = records(d1)
+	for _, batch := range [][]pipeline.Equity{eqs[:1], eqs[1:]} {
+		if err := w.Write(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.End(&pipeline.ResourceResult{Resource: source.Resource(d1), Records: len(eqs)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second fails to parse after its first batch is written
+	if err := w.Write(records(d2)[:1]); err != nil {
+		t.Fatal(err)
+	}
+	var failed = &pipeline.ResourceResult{Resource: source.Resource(d2), Records: 1, Err: errors.New("unexpected EOF")}
+	if err := w.End(failed); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, conn, "SELECT COUNT(*) FROM equity WHERE trading_date = '2021-03-04'"); n != 2 {
+		t.Errorf("expected 2 rows of the released resource; got %d", n)
+	}
+	if n := count(t, conn, "SELECT COUNT(*) FROM equity WHERE trading_date = '2021-03-05'"); n != 0 {
+		t.Errorf("expected rows of the failed resource to be rolled back; got %d", n)
+	}
+	if w.written != 2 || !w.inserted["nse"].Equal(d1) {
+		t.Errorf("expected writer to only count the released resource; got %d written since %v", w.written, w.inserted["nse"])
+	}
+	if !conn.GetAutocommit() {
+		t.Errorf("expected no transaction to be left open")
+	}
+}
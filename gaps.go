@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"crawshaw.io/sqlite"
+	_ "embed"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"go.riyazali.net/bhav/pipeline"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+//go:embed queries/ticker_gaps.sql
+var tickerGaps string // query to fetch days missing for individual tickers
+
+// gaps implements the `gaps` command which reports the expected trading days (per exchange calendar)
+// missing from the database and, optionally, days missing for individual tickers.
+// With --repair, the days missing for an exchange are downloaded again.
+func gaps(args []string) {
+	var since date
+	var tickers, repair bool
+	var ticker string
+
+	var flags = newFlagSet("gaps")
+	flags.Var(&since, "since", "only look for gaps on / after this date")
+	flags.BoolVar(&tickers, "tickers", false, "also report days missing for individual tickers")
+	flags.StringVar(&ticker, "ticker", "", "only report days missing for the given ticker (implies --tickers)")
+	flags.BoolVar(&repair, "repair", false, "download the days missing for an exchange again")
+	flags.Var(&onConflict, "on-conflict", "how to handle records for existing rows: skip, replace or audit")
+	addPipelineFlags(flags)
+	addHttpFlags(flags)
+	_ = flags.Parse(args)
+	configureLogging()
+	configureHttp()
+
+	var conn = openDatabase(filename)
+	defer conn.Close()
+
+	var err error
+	var missing = make(map[*pipeline.Source][]time.Time)
+	var tw = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "exchange\tdate")
+	for _, source := range pipeline.Sources() {
+		if missing[source], err = missingTradingDays(conn, source, time.Time(since)); err != nil {
+			log.Fatal().Err(err).Send()
+		}
+
+		for _, d := range missing[source] {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\n", source.Exchange, d.Format("2006-01-02"))
+		}
+		log.Info().Str("source", source.Name).Int("count", len(missing[source])).Msg("days missing for source")
+	}
+	_ = tw.Flush()
+
+	if tickers || ticker != "" {
+		_, _ = fmt.Fprintln(tw, "\nexchange\tticker\ttype\tdate")
+
+		var n int
+		var stmt = conn.Prep(tickerGaps)
+		stmt.SetText(":since", time.Time(since).Format("2006-01-02"))
+		stmt.SetText(":ticker", ticker)
+		for {
+			if hasRow, err := stmt.Step(); err != nil {
+				log.Fatal().Err(err).Msg("failed to fetch days missing for tickers")
+			} else if !hasRow {
+				break
+			}
+
+			n++
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+				stmt.GetText("exchange"), stmt.GetText("ticker"), stmt.GetText("type"), stmt.GetText("trading_date"))
+		}
+		_ = stmt.Reset()
+		_ = tw.Flush()
+		log.Info().Int("count", n).Msg("days missing for tickers")
+	}
+
+	if repair {
+		repairGaps(conn, missing, time.Time(since))
+	}
+}
+
+// repairGaps downloads the given days (by source) again and inserts them into the database
+func repairGaps(conn *sqlite.Conn, missing map[*pipeline.Source][]time.Time, since time.Time) {
+	// record the run (and the range of days it repairs) in "sync_run" table
+	var run, err = startRun(conn, "gaps")
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+	logRun(run)
+
+	var jobs []pipeline.Job
+	for source, days := range missing {
+		if len(days) == 0 {
+			continue
+		}
+		jobs = append(jobs, pipeline.Job{Source: source, Dates: days})
+
+		var from, to = days[0], days[0]
+		for _, day := range days {
+			if day.Before(from) {
+				from = day
+			}
+			if day.After(to) {
+				to = day
+			}
+		}
+
+		if err = run.addRange(source.Exchange, from, to); err != nil {
+			log.Fatal().Err(err).Send()
+		}
+	}
+
+	log.Info().Msg("repairing days missing for exchanges")
+	var rejected = &quarantined{} // rows that couldn't be parsed
+	var w = newEquityWriter(conn, onConflict, run)
+	if _, err = syncEquities(context.Background(), jobs, w, rejected); err != nil {
+		log.Error().Err(err).Msg("repair stopped")
+	}
+	updateDerived(conn, w.inserted)
+
+	var quarantinedRows = rejected.len()
+	if e := rejected.save(conn); e != nil {
+		log.Error().Err(e).Msg("failed to quarantine rows")
+		err = e
+	}
+
+	if err = run.finish(w, quarantinedRows, err); err != nil {
+		log.Error().Err(err).Send()
+	}
+
+	for source := range missing {
+		var remaining, _ = missingTradingDays(conn, source, since)
+		log.Info().Str("source", source.Name).Int("remaining", len(remaining)).Msg("repaired days missing for source")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"fmt"
+	"go.riyazali.net/bhav/pipeline"
+	"go.riyazali.net/bhav/pipeline/fake"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRepairGaps(t *testing.T) {
+	var server = serve(t)
+	var conn = openDatabase(filepath.Join(t.TempDir(), "bhavcopy.db"))
+	defer conn.Close()
+
+	// nse's report for 3rd isn't published (yet) when the days are first synced
+	var d = func(day int) time.Time { return time.Date(2021, 03, day, 0, 0, 0, 0, time.UTC) }
+	for date := d(1); !date.After(d(5)); date = date.Add(day) {
+		server.AddBse(date, fake.BseReport(date))
+		if date != d(3) {
+			server.AddNse(date, fake.NseReport(date))
+		}
+	}
+	syncDates(conn, d(1), d(5), nil)
+
+	var missing = make(map[*pipeline.Source][]time.Time)
+	for _, source := range pipeline.Sources() {
+		var err error
+		if missing[source], err = missingTradingDays(conn, source, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var nse, _ = pipeline.Lookup("nse/equity")
+	var bse, _ = pipeline.Lookup("bse/equity")
+	if fmt.Sprint(missing[nse]) != fmt.Sprint([]time.Time{d(3)}) || len(missing[bse]) != 0 {
+		t.Fatalf("expected only nse's 3rd to be missing; got %v", missing)
+	}
+
+	server.AddNse(d(3), fake.NseReport(d(3)))
+	repairGaps(conn, missing, time.Time{})
+
+	if remaining, _ := missingTradingDays(conn, nse, time.Time{}); len(remaining) != 0 {
+		t.Errorf("expected no days missing after repair; got %v", remaining)
+	}
+	if n := count(t, conn, "SELECT COUNT(*) FROM equity WHERE exchange = 'nse' AND trading_date = '2021-03-03'"); n != 2 {
+		t.Errorf("got %d rows for the repaired day; want 2", n)
+	}
+
+	// the repair is recorded as a run, along with the range of days it repaired
+	var runs []string
+	const query = `SELECT r.command || ' ' || r.status || ' ' || r.written || ' ' || rr.exchange || ' ' || rr.from_date || ' ' || rr.to_date
+		FROM sync_run r JOIN sync_run_range rr ON rr.run_id = r.id WHERE r.command = 'gaps'`
+	var err = sqlitex.Exec(conn, query, func(stmt *sqlite.Stmt) error {
+		runs = append(runs, stmt.ColumnText(0))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if want := "[gaps succeeded 2 nse 2021-03-03 2021-03-03]"; fmt.Sprint(runs) != want {
+		t.Errorf("got runs %v; want %v", runs, want)
+	}
+}
+
+func TestTickerGaps(t *testing.T) {
+	var conn = openDatabase(filepath.Join(t.TempDir(), "bhavcopy.db"))
+	defer conn.Close()
+
+	// TCS is missing on 3rd; ABC is only listed on 4th and XYZ only traded till 2nd, so neither is missing a day
+	const rows = `INSERT INTO equity (exchange, trading_date, ticker, type, close)
+		VALUES ('nse', '2021-03-01', 'INFY', 'EQ', 1), ('nse', '2021-03-02', 'INFY', 'EQ', 1),
+		       ('nse', '2021-03-03', 'INFY', 'EQ', 1), ('nse', '2021-03-04', 'INFY', 'EQ', 1),
+		       ('nse', '2021-03-01', 'TCS', 'EQ', 1), ('nse', '2021-03-02', 'TCS', 'EQ', 1),
+		       ('nse', '2021-03-04', 'TCS', 'EQ', 1),
+		       ('nse', '2021-03-04', 'ABC', 'EQ', 1),
+		       ('nse', '2021-03-01', 'XYZ', 'EQ', 1), ('nse', '2021-03-02', 'XYZ', 'EQ', 1),
+		       ('bse', '2021-03-01', 'TCS', 'A', 1), ('bse', '2021-03-04', 'TCS', 'A', 1)`
+	if err := sqlitex.ExecScript(conn, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		since, ticker string
+		gaps          []string
+	}{
+		{since: "", ticker: "", gaps: []string{"nse TCS EQ 2021-03-03"}},
+		{since: "", ticker: "TCS", gaps: []string{"nse TCS EQ 2021-03-03"}},
+		{since: "", ticker: "INFY", gaps: nil},
+		{since: "2021-03-04", ticker: "", gaps: nil},
+	}
+
+	var stmt = conn.Prep(tickerGaps)
+	for _, test := range tests {
+		var gaps []string
+		stmt.SetText(":since", test.since)
+		stmt.SetText(":ticker", test.ticker)
+		for {
+			if hasRow, err := stmt.Step(); err != nil {
+				t.Fatal(err)
+			} else if !hasRow {
+				break
+			}
+			gaps = append(gaps, stmt.GetText("exchange")+" "+stmt.GetText("ticker")+" "+
+				stmt.GetText("type")+" "+stmt.GetText("trading_date"))
+		}
+		_ = stmt.Reset()
+
+		if fmt.Sprint(gaps) != fmt.Sprint(test.gaps) {
+			t.Errorf("gaps since %q for %q = %v; want %v", test.since, test.ticker, gaps, test.gaps)
+		}
+	}
+}
@@ -1,11 +1,17 @@
 module go.riyazali.net/bhav
 
-go 1.16
+go 1.18
 
 require (
 	crawshaw.io/sqlite v0.3.2
 	github.com/jszwec/csvutil v1.5.0
+	github.com/peterh/liner v1.2.2
 	github.com/pkg/errors v0.9.1
 	github.com/rs/zerolog v1.21.0
-	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/spf13/pflag v1.0.5
+)
+
+require (
+	github.com/mattn/go-runewidth v0.0.3 // indirect
+	golang.org/x/sys v0.0.0-20211117180635-dee7805ff2e1 // indirect
 )
@@ -0,0 +1,218 @@
+// Package indicators provides technical indicators implemented as sqlite functions.
+//
+// crawshaw.io/sqlite can't register window functions (nor keep state per invocation of an aggregate function),
+// so the indicators (except log_return) are scalar functions over a series: a json array of values in order,
+// as built by sqlite's json_group_array. Used as a window function, json_group_array passes the window's frame
+// to the indicator, which computes the indicator at every row:
+//
+//	SELECT trading_date, sma(json_group_array(close) OVER w, 20)
+//	FROM equity WHERE exchange = 'nse' AND ticker = 'INFY'
+//	WINDOW w AS (ORDER BY trading_date ROWS 19 PRECEDING)
+//
+// Null values in a series are skipped. An indicator is null if the series is too short to compute it.
+package indicators
+
+import (
+	"crawshaw.io/sqlite"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+)
+
+// indicator computes the value of an indicator at the end of the given series (of equal length) over period n
+type indicator func(n int, series ...[]float64) (float64, bool)
+
+// Register registers all the indicator functions on the given connection
+func Register(c *sqlite.Conn) error {
+	var functions = []struct {
+		name   string
+		series int  // number of series the function takes
+		period bool // whether it takes a period (n) after the series
+		fn     indicator
+	}{
+		{"sma", 1, true, sma},
+		{"ema", 1, true, ema},
+		{"rsi", 1, true, rsi},
+		{"atr", 3, true, atr},
+		{"vwap", 2, false, vwap},
+	}
+
+	for _, fn := range functions {
+		var fn = fn
+		var args = fn.series
+		if fn.period {
+			args++
+		}
+
+		var xFunc = func(ctx sqlite.Context, args ...sqlite.Value) {
+			var n = 1
+			if fn.period {
+				n = period(args[fn.series])
+			}
+
+			var series, err = parse(args[:fn.series]...)
+			if err != nil {
+				ctx.ResultError(errors.Wrapf(err, "%s", fn.name))
+				return
+			} else if series == nil {
+				ctx.ResultNull()
+				return
+			}
+
+			if v, ok := fn.fn(n, series...); !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+				ctx.ResultNull()
+			} else {
+				ctx.ResultFloat(v)
+			}
+		}
+
+		if err := c.CreateFunction(fn.name, true, args, xFunc, nil, nil); err != nil {
+			return errors.Wrapf(err, "failed to register %s", fn.name)
+		}
+	}
+
+	return errors.Wrapf(c.CreateFunction("log_return", true, 2, logReturn, nil, nil), "failed to register log_return")
+}
+
+// log_return(value, previous) returns the logarithmic return ln(value / previous)
+func logReturn(ctx sqlite.Context, args ...sqlite.Value) {
+	if args[0].Type() == sqlite.SQLITE_NULL || args[1].Type() == sqlite.SQLITE_NULL || args[0].Float() <= 0 || args[1].Float() <= 0 {
+		ctx.ResultNull()
+		return
+	}
+	ctx.ResultFloat(math.Log(args[0].Float() / args[1].Float()))
+}
+
+// period returns the period argument (n) of an indicator
+func period(v sqlite.Value) int {
+	if n := v.Int(); n > 0 {
+		return n
+	}
+	return 1
+}
+
+// parse parses the series arguments (json arrays) of an indicator, skipping positions where any series is null.
+// It returns nil if any argument is null.
+func parse(args ...sqlite.Value) ([][]float64, error) {
+	var raw = make([][]*float64, len(args))
+	for i, arg := range args {
+		if arg.Type() == sqlite.SQLITE_NULL {
+			return nil, nil
+		}
+		if err := json.Unmarshal([]byte(arg.Text()), &raw[i]); err != nil {
+			return nil, errors.Wrapf(err, "series must be a json array of numbers")
+		}
+		if len(raw[i]) != len(raw[0]) {
+			return nil, fmt.Errorf("series must be of equal length")
+		}
+	}
+
+	var series = make([][]float64, len(args))
+next:
+	for j := range raw[0] {
+		for i := range raw {
+			if raw[i][j] == nil {
+				continue next
+			}
+		}
+		for i := range raw {
+			series[i] = append(series[i], *raw[i][j])
+		}
+	}
+	return series, nil
+}
+
+// sma(series, n) returns the simple moving average of last n values
+func sma(n int, series ...[]float64) (float64, bool) {
+	var values = series[0]
+	if len(values) < n {
+		return 0, false
+	}
+
+	var sum float64
+	for _, v := range values[len(values)-n:] {
+		sum += v
+	}
+	return sum / float64(n), true
+}
+
+// ema(series, n) returns the exponential moving average over period n, seeded with the sma of first n values
+func ema(n int, series ...[]float64) (float64, bool) {
+	var values = series[0]
+	var value, ok = sma(n, values[:min(n, len(values))])
+	if !ok {
+		return 0, false
+	}
+
+	var alpha = 2 / float64(n+1)
+	for _, v := range values[n:] {
+		value = alpha*v + (1-alpha)*value
+	}
+	return value, true
+}
+
+// rsi(series, n) returns the relative strength index over period n using wilder's smoothing
+func rsi(n int, series ...[]float64) (float64, bool) {
+	var values = series[0]
+	if len(values) <= n {
+		return 0, false
+	}
+
+	var gain, loss float64
+	for i := 1; i < len(values); i++ {
+		var change = values[i] - values[i-1]
+		var g, l = math.Max(change, 0), math.Max(-change, 0)
+		if i <= n { // simple average of the first n changes
+			gain, loss = gain+g/float64(n), loss+l/float64(n)
+			continue
+		}
+		gain = (gain*float64(n-1) + g) / float64(n)
+		loss = (loss*float64(n-1) + l) / float64(n)
+	}
+
+	if loss == 0 {
+		return 100, true
+	}
+	return 100 - 100/(1+gain/loss), true
+}
+
+// atr(highs, lows, closes, n) returns the average true range over period n using wilder's smoothing
+func atr(n int, series ...[]float64) (float64, bool) {
+	var high, low, close = series[0], series[1], series[2]
+	if len(close) < n {
+		return 0, false
+	}
+
+	var value float64
+	for i := range close {
+		var tr = high[i] - low[i]
+		if i > 0 {
+			tr = math.Max(tr, math.Max(math.Abs(high[i]-close[i-1]), math.Abs(low[i]-close[i-1])))
+		}
+
+		if i < n { // seed with the simple average of first n true ranges
+			value += tr / float64(n)
+			continue
+		}
+		value = (value*float64(n-1) + tr) / float64(n)
+	}
+	return value, true
+}
+
+// vwap(prices, volumes) returns the volume weighted average price
+func vwap(_ int, series ...[]float64) (float64, bool) {
+	var value, volume float64
+	for i, price := range series[0] {
+		value += price * series[1][i]
+		volume += series[1][i]
+	}
+	return value / volume, volume != 0
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
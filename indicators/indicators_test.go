@@ -0,0 +1,137 @@
+package indicators
+
+import (
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"math"
+	"testing"
+)
+
+func open(t *testing.T) *sqlite.Conn {
+	t.Helper()
+	var conn, err = sqlite.OpenConn(":memory:", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	if err = Register(conn); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// eval evaluates a query returning a single value, returning nil if the value is null
+func eval(t *testing.T, conn *sqlite.Conn, query string) (v *float64) {
+	t.Helper()
+	var fn = func(stmt *sqlite.Stmt) error {
+		if stmt.ColumnType(0) != sqlite.SQLITE_NULL {
+			var f = stmt.ColumnFloat(0)
+			v = &f
+		}
+		return nil
+	}
+	if err := sqlitex.Exec(conn, query, fn); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return v
+}
+
+func TestIndicators(t *testing.T) {
+	var conn = open(t)
+
+	var null = math.NaN() // expect a null
+	var tests = []struct {
+		expr string
+		want float64
+	}{
+		{expr: "sma('[1, 2, 3, 4, 5]', 3)", want: 4},
+		{expr: "sma('[1, 2, 3, null, 4, 5]', 3)", want: 4},
+		{expr: "sma('[1, 2]', 3)", want: null},
+		{expr: "sma(NULL, 3)", want: null},
+
+		// seeded with sma(1, 2, 3) = 2; alpha = 0.5: 4 -> 3, 5 -> 4
+		{expr: "ema('[1, 2, 3, 4, 5]', 3)", want: 4},
+		{expr: "ema('[1, 2, 3]', 3)", want: 2},
+		{expr: "ema('[1, 2]', 3)", want: null},
+
+		// changes +1, +1 (gain 1, loss 0), then -1 (gain 0.5, loss 0.5), then +1 (gain 0.75, loss 0.25)
+		{expr: "rsi('[1, 2, 3, 2, 3]', 2)", want: 75},
+		{expr: "rsi('[1, 2, 3]', 2)", want: 100},
+		{expr: "rsi('[1, 2]', 2)", want: null},
+
+		// true ranges 2, 3 (seed 2.5), then 4 (gap below previous close): (2.5 + 4) / 2
+		{expr: "atr('[10, 12, 11]', '[8, 9, 7]', '[9, 11, 8]', 2)", want: 3.25},
+		{expr: "atr('[10]', '[8]', '[9]', 2)", want: null},
+
+		{expr: "vwap('[10, 20]', '[1, 3]')", want: 17.5},
+		{expr: "vwap('[10, 20]', '[0, 0]')", want: null},
+
+		{expr: "log_return(2.718281828459045, 1)", want: 1},
+		{expr: "log_return(0, 1)", want: null},
+		{expr: "log_return(1, NULL)", want: null},
+	}
+
+	for _, test := range tests {
+		var got = eval(t, conn, "SELECT "+test.expr)
+		if math.IsNaN(test.want) {
+			if got != nil {
+				t.Errorf("%s = %v; want null", test.expr, *got)
+			}
+		} else if got == nil {
+			t.Errorf("%s = null; want %v", test.expr, test.want)
+		} else if math.Abs(*got-test.want) > 1e-9 {
+			t.Errorf("%s = %v; want %v", test.expr, *got, test.want)
+		}
+	}
+
+	for _, invalid := range []string{"sma('not json', 3)", "atr('[1, 2]', '[1]', '[1, 2]', 2)"} {
+		if err := sqlitex.Exec(conn, "SELECT "+invalid, nil); err == nil {
+			t.Errorf("expected %s to fail", invalid)
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	var conn = open(t)
+
+	var script = `
+CREATE TABLE series (ticker TEXT, day INTEGER, close FLOAT);
+INSERT INTO series VALUES ('a', 1, 1), ('a', 2, 2), ('a', 3, 3), ('a', 4, 4), ('b', 1, 10), ('b', 2, 20);`
+	if err := sqlitex.ExecScript(conn, script); err != nil {
+		t.Fatal(err)
+	}
+
+	// the indicator is computed at every row, over the window's frame
+	var got []interface{}
+	var query = `SELECT sma(json_group_array(close) OVER w, 2) FROM series
+		WINDOW w AS (PARTITION BY ticker ORDER BY day ROWS 1 PRECEDING) ORDER BY ticker, day`
+	var fn = func(stmt *sqlite.Stmt) error {
+		if stmt.ColumnType(0) == sqlite.SQLITE_NULL {
+			got = append(got, nil)
+		} else {
+			got = append(got, stmt.ColumnFloat(0))
+		}
+		return nil
+	}
+	if err := sqlitex.Exec(conn, query, fn); err != nil {
+		t.Fatal(err)
+	}
+
+	var want = []interface{}{nil, 1.5, 2.5, 3.5, nil, 15.0}
+	if len(got) != len(want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v; want %v", got, want)
+			break
+		}
+	}
+
+	// used with an aggregate, the indicator is computed at the last row of each group
+	var v = eval(t, conn, `SELECT rsi(json_group_array(close), 2) FROM (SELECT * FROM series WHERE ticker = 'a' ORDER BY day)`)
+	if v == nil || *v != 100 {
+		t.Errorf("expected rsi of a rising series to be 100; got %v", v)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	flag "github.com/spf13/pflag"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// logging options (see addLogFlags)
+var logFormat = logFormatMode("console") // format of the log lines
+var logFile string                       // file to write logs to, instead of stderr
+var logMaxSize int64 = 100               // size (in megabytes) beyond which the log file is rotated
+var logMaxBackups = 5                    // number of rotated log files to keep
+
+// logFormatMode implements pflag.Value for --log-format
+type logFormatMode string
+
+func (m *logFormatMode) String() string { return string(*m) }
+func (m *logFormatMode) Type() string   { return "format" }
+func (m *logFormatMode) Set(s string) error {
+	switch s {
+	case "console", "json":
+		*m = logFormatMode(s)
+		return nil
+	}
+	return fmt.Errorf("must be one of console, json")
+}
+
+// addLogFlags registers flags to configure logging
+// configureLogging() must be called after the flags are parsed
+func addLogFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&verbose, "verbose", false, "enable verbose logging")
+	flags.Var(&logFormat, "log-format", "format of the logs: console or json")
+	flags.StringVar(&logFile, "log-file", "", "file to write logs to (instead of stderr)")
+	flags.Int64Var(&logMaxSize, "log-max-size", logMaxSize, "size (in megabytes) beyond which the log file is rotated; 0 to never rotate")
+	flags.IntVar(&logMaxBackups, "log-max-backups", logMaxBackups, "number of rotated log files to keep")
+}
+
+// configureLogging sets the global log level based on the --verbose flag,
+// and the global logger's output based on the flags registered by addLogFlags
+func configureLogging() {
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	if verbose {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	}
+
+	var out io.Writer = stderr
+	if logFile != "" {
+		var file, err = openRotatingFile(logFile, logMaxSize*1024*1024, logMaxBackups)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to open log file")
+		}
+		out = file
+	}
+
+	if logFormat == "console" {
+		out = zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339, NoColor: logFile != ""}
+	}
+	log.Logger = zerolog.New(out).With().Timestamp().Logger()
+}
+
+// rotatingFile is a log file that's rotated once it grows beyond maxSize bytes: the file is renamed to name.1
+// (after renaming name.1 to name.2, and so on) and a new file is started, keeping at most backups rotated files.
+type rotatingFile struct {
+	sync.Mutex
+	name    string
+	maxSize int64 // zero to never rotate
+	backups int
+	file    *os.File
+	size    int64
+}
+
+// openRotatingFile opens the named log file, appending to it if it exists
+func openRotatingFile(name string, maxSize int64, backups int) (*rotatingFile, error) {
+	var f = &rotatingFile{name: name, maxSize: maxSize, backups: backups}
+	return f, f.open()
+}
+
+func (f *rotatingFile) open() (err error) {
+	if f.file, err = os.OpenFile(f.name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return errors.Wrapf(err, "failed to open %s", f.name)
+	}
+
+	var stat os.FileInfo
+	if stat, err = f.file.Stat(); err != nil {
+		return errors.Wrapf(err, "failed to open %s", f.name)
+	}
+	f.size = stat.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (n int, err error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err = f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate closes the current file, shifts the rotated files (dropping the oldest) and opens a new file
+func (f *rotatingFile) rotate() error {
+	_ = f.file.Close()
+
+	var backup = func(i int) string { return fmt.Sprintf("%s.%d", f.name, i) }
+	_ = os.Remove(backup(f.backups))
+	for i := f.backups - 1; i >= 1; i-- {
+		_ = os.Rename(backup(i), backup(i+1))
+	}
+
+	var err error
+	if f.backups > 0 {
+		err = os.Rename(f.name, backup(1))
+	} else {
+		err = os.Remove(f.name)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to rotate %s", f.name)
+	}
+	return f.open()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	var name = filepath.Join(t.TempDir(), "bhav.log")
+	var f, err = openRotatingFile(name, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} { // each line fills a file
+		if _, err = f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = f.file.Close()
+
+	for file, expected := range map[string]string{name: "fourth\n", name + ".1": "third\n", name + ".2": "second\n"} {
+		if content, _ := os.ReadFile(file); string(content) != expected {
+			t.Errorf("%s: expected %q; got %q", filepath.Base(file), expected, content)
+		}
+	}
+
+	if _, err = os.Stat(name + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 rotated files")
+	}
+
+	// reopening appends to the existing file
+	if f, err = openRotatingFile(name, 100, 2); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("fifth\n"))
+	_ = f.file.Close()
+	if content, _ := os.ReadFile(name); !strings.HasPrefix(string(content), "fourth\n") {
+		t.Errorf("expected log file to be appended to; got %q", content)
+	}
+}
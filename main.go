@@ -1,49 +1,47 @@
 package main
 
 import (
+	"context"
 	"crawshaw.io/sqlite"
-	"crawshaw.io/sqlite/sqlitex"
-	_ "embed"
 	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	flag "github.com/spf13/pflag"
 	"go.riyazali.net/bhav/pipeline"
-	"go.riyazali.net/bhav/schema"
 	"os"
-	"sync"
+	"os/signal"
 	"time"
 )
 
-//go:embed queries/insert_equity.sql
-var insertIntoEquity string // query to insert data into "equity" table
-
-//go:embed queries/last_trading_date_by_exchange.sql
-var lastTradingDate string // query to fetch last trading date by exchange
-
-// minimum dates for bse and nse
-var (
-	BseMinimumDate = time.Date(2007, 01, 01, 0, 0, 0, 0, time.FixedZone("IST", 0530))
-	NseMinimumDate = time.Date(1994, 11, 03, 0, 0, 0, 0, time.FixedZone("IST", 0530))
-)
-
 // flags used by the tool
 var filename string          // database file name
 var savePatch bool           // should write patch file?
 var fromDate date            // date to start syncing from
 var until = date(time.Now()) // hidden flag to set the end date for sync; default to today
 var verbose bool             // set to verbose logging
+var bseCompanies string      // path to bse's list of listed companies
+var verifyAfterSync bool     // run data quality checks after sync?
+
+var onConflict = conflictMode(onConflictSkip) // how to resolve conflicts with existing rows in "equity" table
+
+var pipelineOptions = pipeline.DefaultOptions() // concurrency options for the pipeline
 
 func init() {
 	// set the default package-level logger
-	log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).
+	log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: stderr, TimeFormat: time.RFC3339}).
 		With().Timestamp().Logger()
 
 	// configure flags
 	flag.StringVar(&filename, "filename", "bhavcopy.db", "database file to sync")
 	flag.BoolVar(&savePatch, "save-patch", false, "save changeset to a patch file")
 	flag.Var(&fromDate, "from", "date to start syncing from")
-	flag.BoolVar(&verbose, "verbose", false, "enable verbose logging")
+	flag.StringVar(&bseCompanies, "bse-companies", "", "csv file with bse's list of listed companies")
+	flag.BoolVar(&verifyAfterSync, "verify", false, "run data quality checks after sync and save the report")
+	flag.Var(&onConflict, "on-conflict", "how to handle records for existing rows (like re-published reports): skip, replace or audit")
+
+	addPipelineFlags(flag.CommandLine)
+	addLogFlags(flag.CommandLine)
+	addHttpFlags(flag.CommandLine)
 
 	flag.Var(&until, "until", "date to sync until")
 	_ = flag.CommandLine.MarkHidden("until")
@@ -51,20 +49,19 @@ func init() {
 
 func main() {
 	var err error
-	flag.Parse()
-
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	if verbose {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	if len(os.Args) > 1 { // invoked with a sub-command?
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
 	}
 
+	flag.Parse()
+	configureLogging()
+	configureHttp()
+
 	// open a connection and start a session to record changes to the dataset
-	log.Info().Str("file", filename).Msg("opening database file")
-	var conn *sqlite.Conn
-	const flags = sqlite.SQLITE_OPEN_CREATE | sqlite.SQLITE_OPEN_READWRITE
-	if conn, err = sqlite.OpenConn(filename, flags); err != nil {
-		log.Fatal().Err(err).Msg("failed to open database file")
-	}
+	var conn = openDatabase(filename)
 
 	var session *sqlite.Session
 	if session, err = conn.CreateSession("main"); err != nil {
@@ -75,71 +72,67 @@ func main() {
 		log.Fatal().Err(err).Msg("failed to attach tables to session")
 	}
 
-	log.Info().Msgf("applying schema migration to %s", filename)
-	if err := schema.Apply(conn); err != nil {
-		log.Fatal().Err(err).Msg("failed to apply migration")
+	if err = loadBseCompanies(conn, bseCompanies); err != nil {
+		log.Fatal().Err(err).Msg("failed to load bse companies")
 	}
 
 	log.Info().Msg("computing time delta")
-	// figure out start date; end date is always today
+	// figure out start date for each source; end date is always today
 	var end = time.Time(until)
-	var bseLast, nseLast = minDatabaseDate(conn) // last trading day recorded in the database
-
-	var bseStart = closest(end, BseMinimumDate, time.Time(fromDate), bseLast.Add(time.Hour*24))
-	var nseStart = closest(end, NseMinimumDate, time.Time(fromDate), nseLast.Add(time.Hour*24))
-	log.Debug().Time("bse", bseStart).Time("nse", nseStart).Time("end", end).Msg("computed time delta")
+	var starts, since = syncStarts(conn, end)
 
-	// create a background pipeline to process equity data
-	var in, out = pipeline.EquityPipeline()
-	var ins = conn.Prep(insertIntoEquity)
+	var rejected = &quarantined{} // rows that couldn't be parsed
+	var run *syncRun
 
-	if bseStart.After(end) && nseStart.After(end) { // no data to fetch
+	if len(starts) == 0 { // no data to fetch
 		log.Info().Msg("everything is in sync")
 		goto end
 	}
 
-	{ // start background enqueue tasks to push resources into input channel
-		// use WaitGroup to close input once we're done enqueuing
-		log.Debug().Msg("starting enqueue process")
-		var wg sync.WaitGroup
-		wg.Add(2)
-		go EnqueueEquity(bseStart, end, &wg, "bse", pipeline.NewBseEquity, in)
-		go EnqueueEquity(nseStart, end, &wg, "nse", pipeline.NewNseEquity, in)
-		go func() { wg.Wait(); close(in) }()
+	// record the run (and the range of dates it syncs) in "sync_run" table
+	if run, err = startRun(conn, "sync"); err != nil {
+		log.Fatal().Err(err).Send()
+	}
+	logRun(run)
+	for source, start := range starts {
+		if err = run.addRange(source.Exchange, start, end); err != nil {
+			log.Fatal().Err(err).Send()
+		}
 	}
 
-	log.Debug().Msg("enabling sqlite session")
-	session.Enable()
-	{
-		// range over output and insert records into database
-		for eqs := range out {
-			_ = sqlitex.Exec(conn, "BEGIN", nil)
-			for _, eq := range eqs {
-				ins.SetText(":exchange", eq.Exchange())
-				ins.SetText(":trading_date", eq.TradingDate().Format("2006-01-02"))
-				ins.SetText(":ticker", eq.Ticker())
-				ins.SetText(":type", eq.Type())
-				ins.SetText(":isin_code", eq.ISIN())
-
-				var o, h, l, c = eq.OHLC()
-				ins.SetFloat(":open", o)
-				ins.SetFloat(":high", h)
-				ins.SetFloat(":low", l)
-				ins.SetFloat(":close", c)
-
-				ins.SetFloat(":last", eq.Last())
-				ins.SetFloat(":previous_close", eq.PrevClose())
-
-				if _, err = ins.Step(); err != nil {
-					log.Warn().Err(err).Msg("failed to insert row")
-				}
-				_ = ins.Reset()
-			}
-			_ = sqlitex.Exec(conn, "COMMIT", nil)
+	{ // sync the records into the database, recording the changes in the session
+		var jobs []pipeline.Job
+		for source, start := range starts {
+			jobs = append(jobs, pipeline.Job{Source: source, From: start, To: end})
+		}
+
+		// stop enqueuing on interrupt, keeping the records synced till then
+		var ctx, stop = signal.NotifyContext(context.Background(), os.Interrupt)
+
+		log.Debug().Msg("enabling sqlite session")
+		session.Enable()
+		var w = newEquityWriter(conn, onConflict, run)
+		if _, err = syncEquities(ctx, jobs, w, rejected); err != nil {
+			log.Error().Err(err).Msg("sync stopped")
+		}
+		stop()
+
+		var quarantinedRows = rejected.len()
+		if e := rejected.save(conn); e != nil {
+			log.Error().Err(e).Msg("failed to quarantine rows")
+			err = e
+		}
+
+		log.Debug().Msg("disabling sqlite session")
+		session.Disable()
+
+		// derived data is updated outside the session, keeping it out of the patch (consumers derive it themselves)
+		updateDerived(conn, w.inserted)
+
+		if err = run.finish(w, quarantinedRows, err); err != nil {
+			log.Error().Err(err).Send()
 		}
 	}
-	log.Debug().Msg("disabling sqlite session")
-	session.Disable()
 
 	if savePatch { // should save patch?
 		var patchFileName = fmt.Sprintf("%s.patch", filename)
@@ -157,8 +150,71 @@ func main() {
 		log.Info().Str("filename", patchFileName).Msg("changeset written to patch file")
 	}
 
+	if verifyAfterSync { // run data quality checks on data synced in this run
+		var reportFileName = fmt.Sprintf("%s.verify.json", filename)
+		log.Info().Msg("running data quality checks")
+
+		var report *Report
+		if report, err = verifyDatabase(conn, verifyOptions{since: since, maxJump: 20, limit: 100}); err != nil {
+			log.Error().Err(err).Msg("failed to verify database")
+		} else if err = writeReport(report, reportFileName); err != nil {
+			log.Error().Err(err).Msg("failed to write report")
+		} else {
+			logReport(report)
+			log.Info().Str("filename", reportFileName).Msg("data quality report written to file")
+		}
+	}
+
 end:
 
 	session.Delete() // close the session
 	_ = conn.Close()
 }
+
+// number of days before the last trading day recorded that are synced again when updating existing rows
+// (--on-conflict replace or audit) without --from, to pick up reports the exchange re-published
+const resyncDays = 7
+
+// syncStarts returns the date to start syncing each source from (skipping sources with nothing to sync till end),
+// and the earliest start date across all sources. A sync resumes after the last trading day recorded for the exchange
+// (or from --from, if later). When updating existing rows (--on-conflict replace or audit), days already recorded are
+// synced again, from --from or resyncDays before the last trading day recorded.
+func syncStarts(conn *sqlite.Conn, end time.Time) (starts map[*pipeline.Source]time.Time, since time.Time) {
+	since = end.Add(day)
+	starts = make(map[*pipeline.Source]time.Time)
+	for _, source := range pipeline.Sources() {
+		var last = lastSyncDate(conn, source.Exchange) // last trading day recorded in the database
+		var start = closest(end, source.Start, time.Time(fromDate), last.Add(day))
+		if onConflict != onConflictSkip && !last.IsZero() {
+			var from = time.Time(fromDate)
+			if from.IsZero() {
+				from = last.AddDate(0, 0, -resyncDays)
+			}
+			start = closest(end, source.Start, from)
+		}
+
+		if !start.After(end) {
+			starts[source] = start
+		}
+
+		if start.Before(since) {
+			since = start
+		}
+		log.Debug().Str("source", source.Name).Time("start", start).Time("end", end).Msg("computed time delta")
+	}
+	return starts, since
+}
+
+// updateDerived updates the data derived from "equity" table (candles and adjusted prices)
+// after new records (with the given earliest trading date per exchange) are inserted
+func updateDerived(conn *sqlite.Conn, inserted map[string]time.Time) {
+	log.Info().Msg("updating candles")
+	if err := updateCandles(conn, inserted); err != nil {
+		log.Error().Err(err).Msg("failed to update candles")
+	}
+
+	log.Info().Msg("updating price adjustments")
+	if err := updateAdjustments(conn); err != nil {
+		log.Error().Err(err).Msg("failed to update price adjustments")
+	}
+}
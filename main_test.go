@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"go.riyazali.net/bhav/pipeline"
+	"go.riyazali.net/bhav/pipeline/fake"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// syncDates syncs the data published by all sources between from and to (inclusive) into the database,
+// returning the earliest date inserted per exchange. Rows that couldn't be parsed are passed to rejected (if set).
+func syncDates(conn *sqlite.Conn, from, to time.Time, rejected *quarantined) map[string]time.Time {
+	if rejected == nil {
+		rejected = &quarantined{}
+	}
+
+	var jobs []pipeline.Job
+	for _, source := range pipeline.Sources() {
+		jobs = append(jobs, pipeline.Job{Source: source, From: from, To: to})
+	}
+
+	var w = newEquityWriter(conn, onConflict, nil)
+	_, _ = syncEquities(context.Background(), jobs, w, rejected)
+	updateDerived(conn, w.inserted)
+	return w.inserted
+}
+
+// count returns the result of a query that counts rows
+func count(t *testing.T, conn *sqlite.Conn, query string) (n int) {
+	t.Helper()
+	if err := sqlitex.Exec(conn, query, func(stmt *sqlite.Stmt) error { n = stmt.ColumnInt(0); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// serve starts a fake exchange and redirects requests to exchanges to it till the test ends
+func serve(t *testing.T) *fake.Server {
+	var server = fake.NewServer()
+	var client = pipeline.Client
+	pipeline.Client = server.Client()
+	t.Cleanup(func() { pipeline.Client = client; server.Close() })
+	return server
+}
+
+// TestSync runs the pipeline end-to-end against a fake exchange, into a temporary database
+func TestSync(t *testing.T) {
+	var server = serve(t)
+
+	var from, to = time.Date(2021, 03, 01, 0, 0, 0, 0, time.UTC), time.Date(2021, 03, 14, 0, 0, 0, 0, time.UTC)
+	var days int
+	for d := from; !d.After(to); d = d.Add(day) {
+		if !pipeline.Holiday(d) {
+			server.AddBse(d, fake.BseReport(d))
+			server.AddNse(d, fake.NseReport(d))
+			days++
+		}
+	}
+
+	var conn = openDatabase(filepath.Join(t.TempDir(), "bhavcopy.db"))
+	defer conn.Close()
+
+	var inserted = syncDates(conn, from, to, nil)
+
+	for _, exchange := range []string{"bse", "nse"} {
+		if !inserted[exchange].Equal(time.Date(2021, 03, 01, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s: expected earliest inserted date to be 2021-03-01; got %s", exchange, inserted[exchange])
+		}
+
+		if last := lastSyncDate(conn, exchange); last.Format("2006-01-02") != "2021-03-12" {
+			t.Errorf("%s: expected last sync date to be 2021-03-12; got %s", exchange, last)
+		}
+	}
+
+	if n := count(t, conn, "SELECT COUNT(*) FROM equity"); n != 2*2*days {
+		t.Errorf("expected %d rows in equity; got %d", 2*2*days, n)
+	}
+
+	if n := count(t, conn, "SELECT COUNT(*) FROM equity WHERE exchange = 'bse' AND ticker IN ('INFY', 'TCS')"); n != 2*days {
+		t.Errorf("expected bse scrip codes to be resolved to tickers; got %d resolved rows", n)
+	}
+
+	if n := count(t, conn, "SELECT COUNT(*) FROM equity_weekly WHERE exchange = 'nse' AND ticker = 'INFY'"); n != 2 {
+		t.Errorf("expected 2 weekly candles; got %d", n)
+	}
+}
+
+func TestSyncStarts(t *testing.T) {
+	var server = serve(t)
+	var conn = openDatabase(filepath.Join(t.TempDir(), "bhavcopy.db"))
+	defer conn.Close()
+
+	var d = func(day int) time.Time { return time.Date(2021, 03, day, 0, 0, 0, 0, time.UTC) }
+	server.AddNse(d(5), fake.NseReport(d(5)))
+	server.AddBse(d(4), fake.BseReport(d(4)))
+	syncDates(conn, d(4), d(5), nil) // nse is synced till 5th, bse till 4th
+
+	defer func(from date, mode conflictMode) { fromDate, onConflict = from, mode }(fromDate, onConflict)
+
+	var tests = []struct {
+		name     string
+		from     time.Time
+		mode     conflictMode
+		bse, nse time.Time // expected start dates; zero to expect the source be skipped
+	}{
+		{name: "resume", mode: onConflictSkip, bse: d(5), nse: d(6)},
+		{name: "from before last", from: d(1), mode: onConflictSkip, bse: d(5), nse: d(6)},
+		{name: "from after last", from: d(7), mode: onConflictSkip, bse: d(7), nse: d(7)},
+		{name: "replace from", from: d(3), mode: onConflictReplace, bse: d(3), nse: d(3)},
+		{name: "replace", mode: onConflictReplace, bse: d(4).AddDate(0, 0, -resyncDays), nse: d(5).AddDate(0, 0, -resyncDays)},
+		{name: "audit", mode: onConflictAudit, bse: d(4).AddDate(0, 0, -resyncDays), nse: d(5).AddDate(0, 0, -resyncDays)},
+		{name: "from after end", from: d(11), mode: onConflictAudit},
+	}
+
+	for _, test := range tests {
+		fromDate, onConflict = date(test.from), test.mode
+
+		var expected = map[string]time.Time{"bse": test.bse, "nse": test.nse}
+		var starts, _ = syncStarts(conn, d(10))
+		for _, source := range pipeline.Sources() {
+			if start := starts[source]; !start.Equal(expected[source.Exchange]) {
+				t.Errorf("%s: expected %s to start at %s; got %s", test.name, source.Name, expected[source.Exchange], start)
+			}
+		}
+	}
+
+	// a report re-published by the exchange is picked up by a sync from the computed start dates
+	server.AddNse(d(5), strings.Replace(fake.NseReport(d(5)), "1310.00,1310.00,", "1311.00,1311.00,", 1))
+	fromDate, onConflict = date{}, onConflictReplace
+	var starts, _ = syncStarts(conn, d(5))
+
+	var jobs []pipeline.Job
+	for source, start := range starts {
+		jobs = append(jobs, pipeline.Job{Source: source, From: start, To: d(5)})
+	}
+	_, _ = syncEquities(context.Background(), jobs, newEquityWriter(conn, onConflict, nil), &quarantined{})
+
+	if n := count(t, conn, "SELECT COUNT(*) FROM equity WHERE exchange = 'nse' AND ticker = 'INFY' AND close = 1311"); n != 1 {
+		t.Errorf("expected the re-published report to replace the stored row")
+	}
+}
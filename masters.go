@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	_ "embed"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"go.riyazali.net/bhav/pipeline"
+	"os"
+	"time"
+)
+
+//go:embed queries/upsert_bse_company.sql
+var upsertBseCompany string // query to insert / update an entry in "bse_company" table
+
+//go:embed queries/select_bse_company.sql
+var selectBseCompany string // query to fetch all entries from "bse_company" table
+
+//go:embed queries/resolve_bse_tickers.sql
+var resolveBseTickers string // query to re-resolve bse tickers stored as bare scrip codes
+
+//go:embed queries/delete_duplicate_bse_tickers.sql
+var deleteDuplicateBseTickers string // query to delete bare scrip code rows that duplicate a resolved row
+
+// readBseCompaniesFile reads bse's list of listed companies from the given csv file
+func readBseCompaniesFile(name string) (_ []pipeline.BseCompany, err error) {
+	var file *os.File
+	if file, err = os.Open(name); err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", name)
+	}
+	defer file.Close()
+
+	return pipeline.ReadBseCompanies(file)
+}
+
+// loadBseCompanies loads bse's list of listed companies into the pipeline, overriding the list
+// embedded in the binary. Entries are read from the "bse_company" table and from the csv file (if provided).
+func loadBseCompanies(c *sqlite.Conn, file string) (err error) {
+	var companies []pipeline.BseCompany
+	err = sqlitex.Exec(c, selectBseCompany, func(stmt *sqlite.Stmt) error {
+		companies = append(companies, pipeline.BseCompany{
+			ScripCode:    stmt.GetText("scrip_code"),
+			SecurityId:   stmt.GetText("security_id"),
+			SecurityName: stmt.GetText("security_name"),
+			Status:       stmt.GetText("status"),
+			ISIN:         stmt.GetText("isin_code"),
+		})
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to read bse companies from database")
+	}
+
+	if file != "" {
+		var fromFile []pipeline.BseCompany
+		if fromFile, err = readBseCompaniesFile(file); err != nil {
+			return err
+		}
+		companies = append(companies, fromFile...)
+	}
+
+	log.Debug().Int("count", len(companies)).Msg("loading bse companies")
+	pipeline.RegisterBseCompanies(companies...)
+	return nil
+}
+
+// refreshMasters implements the `refresh-masters` command which imports a new list of listed companies
+// and symbol changes into the database, re-resolves bse tickers that were stored as bare scrip codes
+// and infers symbol changes from continuity of isin in the stored data.
+func refreshMasters(args []string) {
+	var bse string        // path to bse's list of listed companies
+	var nseSymbols string // path to nse's list of symbol changes
+
+	var flags = newFlagSet("refresh-masters")
+	flags.StringVar(&bse, "bse", "", "path to bse's list of listed companies (csv)")
+	flags.StringVar(&nseSymbols, "nse-symbol-changes", "", "path to nse's list of symbol changes (csv); use 'download' to fetch it from nse")
+	addHttpFlags(flags)
+	_ = flags.Parse(args)
+	configureLogging()
+	configureHttp()
+
+	var err error
+	var companies []pipeline.BseCompany
+	if bse != "" {
+		if companies, err = readBseCompaniesFile(bse); err != nil {
+			log.Fatal().Err(err).Msg("failed to read list of companies")
+		}
+	}
+
+	var changes []pipeline.SymbolChange
+	if nseSymbols != "" {
+		if changes, err = readNseSymbolChanges(nseSymbols); err != nil {
+			log.Fatal().Err(err).Msg("failed to read list of symbol changes")
+		}
+	}
+
+	var conn = openDatabase(filename)
+	defer conn.Close()
+
+	err = func() (err error) {
+		defer sqlitex.Save(conn)(&err) // import everything or nothing
+
+		var ups = conn.Prep(upsertBseCompany)
+		for _, company := range companies {
+			ups.SetText(":scrip_code", company.ScripCode)
+			ups.SetText(":security_id", company.SecurityId)
+			ups.SetText(":security_name", company.SecurityName)
+			ups.SetText(":status", company.Status)
+			ups.SetText(":isin_code", company.ISIN)
+			if _, err = ups.Step(); err != nil {
+				return errors.Wrapf(err, "failed to import scrip code %s", company.ScripCode)
+			}
+			_ = ups.Reset()
+		}
+		log.Info().Int("count", len(companies)).Msg("imported bse companies")
+
+		var n, duplicates int
+		if n, duplicates, err = resolveTickers(conn); err != nil {
+			return err
+		}
+		if duplicates > 0 {
+			log.Warn().Int("count", duplicates).Msg("deleted bse rows stored under scrip code that duplicate rows stored under security id")
+		}
+		log.Info().Int("count", n).Msg("re-resolved bse tickers")
+
+		if n, err = importSymbolChanges(conn, changes); err != nil {
+			return err
+		}
+		log.Info().Int("count", n).Msg("imported symbol changes")
+
+		if n, err = inferTickerChanges(conn); err != nil {
+			return err
+		}
+		log.Info().Int("count", n).Msg("inferred symbol changes")
+
+		return nil
+	}()
+
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to refresh masters")
+	}
+}
+
+// resolveTickers re-resolves bse tickers stored as bare scrip codes to their security id, returning the number
+// of rows re-resolved. Rows for days already stored under the security id are deleted instead (and counted
+// as duplicates). Candles of the re-resolved tickers are recomputed under the security id.
+func resolveTickers(c *sqlite.Conn) (resolved, duplicates int, err error) {
+	defer sqlitex.Save(c)(&err)
+
+	const scripCodes = "SELECT scrip_code FROM bse_company WHERE security_id <> ''"
+
+	var since = make(map[string]time.Time) // date to recompute candles from
+	var earliest = "SELECT MIN(trading_date) FROM equity WHERE exchange = 'bse' AND ticker IN (" + scripCodes + ")"
+	err = sqlitex.Exec(c, earliest, func(stmt *sqlite.Stmt) error {
+		if date, err := time.Parse("2006-01-02", stmt.ColumnText(0)); err == nil {
+			since["bse"] = date
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "failed to query bse tickers to re-resolve")
+	}
+
+	if err = sqlitex.Exec(c, deleteDuplicateBseTickers, nil); err != nil {
+		return 0, 0, errors.Wrapf(err, "failed to delete duplicate bse rows")
+	}
+	duplicates = c.Changes()
+
+	if err = sqlitex.Exec(c, resolveBseTickers, nil); err != nil {
+		return 0, 0, errors.Wrapf(err, "failed to re-resolve bse tickers")
+	}
+	resolved = c.Changes()
+
+	if len(since) == 0 {
+		return resolved, duplicates, nil
+	}
+
+	for _, tf := range timeframes { // drop candles of the scrip codes; they're recomputed under the security id
+		if err = sqlitex.Exec(c, "DELETE FROM "+tf.table+" WHERE exchange = 'bse' AND ticker IN ("+scripCodes+")", nil); err != nil {
+			return 0, 0, errors.Wrapf(err, "failed to delete %s candles", tf.table)
+		}
+	}
+
+	if err = updateCandles(c, since); err != nil {
+		return 0, 0, errors.Wrapf(err, "failed to update candles")
+	}
+
+	return resolved, duplicates, nil
+}
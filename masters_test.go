@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crawshaw.io/sqlite/sqlitex"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolveTickers(t *testing.T) {
+	var conn = openDatabase(filepath.Join(t.TempDir(), "bhavcopy.db"))
+	defer conn.Close()
+
+	// 500325 was synced as a bare scrip code on 1st and 2nd; 2nd was synced again after it was listed
+	const rows = `INSERT INTO equity (exchange, trading_date, ticker, type, open, high, low, close, volume)
+		VALUES ('bse', '2021-03-01', '500325', 'A', 10, 12, 9, 11, 100),
+		       ('bse', '2021-03-02', '500325', 'A', 11, 13, 10, 12, 100),
+		       ('bse', '2021-03-02', 'RELIANCE', 'A', 11, 13, 10, 12, 100)`
+	if err := sqlitex.ExecScript(conn, rows); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateCandles(conn, map[string]time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	const company = `INSERT INTO bse_company (scrip_code, security_id, isin_code) VALUES ('500325', 'RELIANCE', 'INE002A01018')`
+	if err := sqlitex.Exec(conn, company, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var resolved, duplicates, err = resolveTickers(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resolved != 1 || duplicates != 1 {
+		t.Errorf("resolveTickers() = %d resolved, %d duplicates; want 1, 1", resolved, duplicates)
+	}
+
+	if n := count(t, conn, "SELECT COUNT(*) FROM equity WHERE ticker = '500325'"); n != 0 {
+		t.Errorf("got %d rows under scrip code; want 0", n)
+	}
+
+	if n := count(t, conn, "SELECT COUNT(*) FROM equity WHERE ticker = 'RELIANCE'"); n != 2 {
+		t.Errorf("got %d rows under security id; want 2", n)
+	}
+
+	if n := count(t, conn, "SELECT COUNT(*) FROM equity_weekly WHERE ticker = '500325'"); n != 0 {
+		t.Errorf("got %d weekly candles under scrip code; want 0", n)
+	}
+
+	const candle = "SELECT COUNT(*) FROM equity_weekly WHERE ticker = 'RELIANCE' AND first_date = '2021-03-01' AND volume = 200"
+	if n := count(t, conn, candle); n != 1 {
+		t.Errorf("got %d weekly candles under security id spanning both days; want 1", n)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crawshaw.io/sqlite"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"go.riyazali.net/bhav/schema"
+	"os"
+	"text/tabwriter"
+)
+
+// migrate implements the `migrate` command to inspect and manage schema migrations of the database.
+//
+//	bhav migrate status          lists the migrations and whether they're applied
+//	bhav migrate [up]            applies the pending migrations (done by every other command as well)
+//	bhav migrate down --to N     rolls back the migrations after version N (using their vN.down.sql scripts)
+//
+// With --dry-run, up and down print the scripts they'd execute instead of executing them.
+func migrate(args []string) {
+	var dryRun bool
+	var to int64
+
+	var flags = newFlagSet("migrate")
+	flags.BoolVar(&dryRun, "dry-run", false, "print the scripts that would be executed, without executing them")
+	flags.Int64Var(&to, "to", -1, "version to roll back to (with down)")
+	_ = flags.Parse(args)
+	configureLogging()
+
+	var action = "up"
+	if flags.NArg() > 0 {
+		action = flags.Arg(0)
+	}
+
+	// the database is opened without applying the migrations (unlike openDatabase)
+	log.Info().Str("file", filename).Msg("opening database file")
+	const openFlags = sqlite.SQLITE_OPEN_CREATE | sqlite.SQLITE_OPEN_READWRITE
+	var conn, err = sqlite.OpenConn(filename, openFlags)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open database file")
+	}
+	defer conn.Close()
+
+	switch action {
+	case "status":
+		err = migrationStatus(conn)
+	case "up":
+		var pending []*schema.Migration
+		if pending, err = schema.Pending(conn); err == nil && dryRun {
+			printScripts(pending, false)
+		} else if err == nil {
+			if err = schema.Apply(conn); err == nil {
+				log.Info().Int("applied", len(pending)).Msg("applied pending migrations")
+			}
+		}
+	case "down":
+		if to < 0 {
+			log.Fatal().Msg("--to is required to roll back")
+		}
+
+		var rollback []*schema.Migration
+		if rollback, err = schema.RollbackPlan(conn, to); err == nil && dryRun {
+			printScripts(rollback, true)
+		} else if err == nil {
+			if err = schema.Rollback(conn, to); err == nil {
+				log.Info().Int("rolled_back", len(rollback)).Msgf("rolled back to v%d", to)
+			}
+		}
+	default:
+		log.Fatal().Msgf("unknown action %q; expected status, up or down", action)
+	}
+
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to migrate database")
+	}
+}
+
+// migrationStatus prints the status of each migration in the database
+func migrationStatus(conn *sqlite.Conn) (err error) {
+	var current int64
+	if current, err = schema.Version(conn); err != nil {
+		return err
+	}
+
+	var status []*schema.MigrationStatus
+	if status, err = schema.Status(conn); err != nil {
+		return err
+	}
+
+	var pending int
+	var tw = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "version\tname\tstatus\tapplied at\trollback\tchecksum")
+	for _, s := range status {
+		var state = "pending"
+		switch {
+		case s.Modified():
+			state = "modified"
+		case s.Applied && s.Recorded == "":
+			state = "applied (unrecorded)"
+		case s.Applied:
+			state = "applied"
+		default:
+			pending++
+		}
+
+		var rollback = "no"
+		if s.Down != "" {
+			rollback = "yes"
+		}
+		_, _ = fmt.Fprintf(tw, "v%d\t%s\t%s\t%s\t%s\t%.12s\n", s.Version, s.Name, state, s.AppliedAt, rollback, s.Checksum)
+	}
+	_ = tw.Flush()
+
+	fmt.Printf("\ndatabase is at v%d (latest is v%d); %d pending\n", current, len(status), pending)
+	return nil
+}
+
+// printScripts prints the scripts (to apply, or to roll back) the migrations, in order
+func printScripts(migrations []*schema.Migration, down bool) {
+	if len(migrations) == 0 {
+		log.Info().Msg("nothing to do")
+		return
+	}
+
+	for _, migration := range migrations {
+		var script = migration.Up
+		var name = migration.Name
+		if down {
+			script, name = migration.Down, fmt.Sprintf("v%d.down.sql", migration.Version)
+		}
+		fmt.Printf("-- %s\n%s\n", name, script)
+	}
+}
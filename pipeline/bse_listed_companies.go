@@ -5,14 +5,17 @@ import (
 	_ "embed"
 	scsv "encoding/csv"
 	csv "github.com/jszwec/csvutil"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"io"
+	"sync"
 )
 
 //go:embed bse_listed_companies.csv
 var listOfListedCompanies []byte
 
-type bseCompany struct {
+// BseCompany is an entry in BSE's master list of listed companies
+type BseCompany struct {
 	ScripCode    string `csv:"Security Code"`
 	SecurityId   string `csv:"Security Id"`
 	SecurityName string `csv:"Security Name"`
@@ -21,25 +24,56 @@ type bseCompany struct {
 }
 
 // map of scrip code to company details populated using csv
-var scripCodes = make(map[string]bseCompany)
+// the map can be updated at runtime (see RegisterBseCompanies) hence the lock
+var scripCodes = struct {
+	sync.RWMutex
+	m map[string]BseCompany
+}{m: make(map[string]BseCompany)}
 
-func bseLookup(code string) bseCompany { return scripCodes[code] }
+func bseLookup(code string) BseCompany {
+	scripCodes.RLock()
+	defer scripCodes.RUnlock()
+	return scripCodes.m[code]
+}
 
-func init() {
-	var err error
+// RegisterBseCompanies adds (or replaces) the given companies to the list used to resolve
+// a BseEquity's scrip code to its security id and isin. It must be called before
+// the pipeline is started to affect all the records.
+func RegisterBseCompanies(companies ...BseCompany) {
+	scripCodes.Lock()
+	defer scripCodes.Unlock()
+	for _, company := range companies {
+		scripCodes.m[company.ScripCode] = company
+	}
+}
+
+// ReadBseCompanies reads BSE's list of listed companies from the given csv source.
+// The csv must be in the same format as published by the exchange (and as embedded in the binary).
+func ReadBseCompanies(r io.Reader) (_ []BseCompany, err error) {
+	var companies []BseCompany
 
 	var decoder *csv.Decoder
-	if decoder, err = csv.NewDecoder(scsv.NewReader(bytes.NewReader(listOfListedCompanies))); err != nil {
-		log.Fatal().Err(err).Msg("failed to read list of listed companies on bse")
+	if decoder, err = csv.NewDecoder(scsv.NewReader(r)); err != nil {
+		return nil, errors.Wrapf(err, "failed to read list of listed companies")
 	}
 
 	for {
-		var company bseCompany
+		var company BseCompany
 		if err = decoder.Decode(&company); err == io.EOF {
 			break
 		} else if err != nil {
-			log.Fatal().Err(err).Msg("failed to read row from csv")
+			return nil, errors.Wrapf(err, "failed to read row from csv")
 		}
-		scripCodes[company.ScripCode] = company
+		companies = append(companies, company)
+	}
+
+	return companies, nil
+}
+
+func init() {
+	var companies, err = ReadBseCompanies(bytes.NewReader(listOfListedCompanies))
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to read list of listed companies on bse")
 	}
+	RegisterBseCompanies(companies...)
 }
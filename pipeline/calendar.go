@@ -0,0 +1,32 @@
+package pipeline
+
+import "time"
+
+// fixed date (month, day) national holidays observed by indian exchanges
+var holidays = [][2]int{
+	{1, 26},  // republic day
+	{4, 14},  // regional new year
+	{5, 1},   // may day
+	{8, 15},  // independence day
+	{10, 2},  // gandhi jayanthi
+	{12, 25}, // christmas
+}
+
+// Holiday is the default calendar used by sources. It returns true if the given date
+// falls on a weekend or on one of the fixed date national holidays.
+func Holiday(d time.Time) bool {
+	if w := d.Weekday(); w == time.Saturday || w == time.Sunday { // is a weekend?
+		return true
+	} else { // falls on a national holiday?
+		for _, h := range holidays {
+			_, month, day := d.Date()
+			if int(month) == h[0] && day == h[1] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ist is the timezone used by indian exchanges
+var ist = time.FixedZone("IST", 0530)
@@ -0,0 +1,37 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHoliday(t *testing.T) {
+	var tests = []struct {
+		date    string
+		holiday bool
+	}{
+		{date: "2021-01-26", holiday: true},  // republic day (tuesday)
+		{date: "2021-04-14", holiday: true},  // regional new year (wednesday)
+		{date: "2021-08-15", holiday: true},  // independence day (sunday)
+		{date: "2022-08-15", holiday: true},  // independence day (monday)
+		{date: "2021-10-02", holiday: true},  // gandhi jayanthi (saturday)
+		{date: "2023-10-02", holiday: true},  // gandhi jayanthi (monday)
+		{date: "2024-12-25", holiday: true},  // christmas (wednesday)
+		{date: "2021-03-06", holiday: true},  // saturday
+		{date: "2021-03-07", holiday: true},  // sunday
+		{date: "2021-01-05", holiday: false}, // working days whose (day, month) is a holiday's (month, day)
+		{date: "2021-02-10", holiday: false},
+		{date: "2022-01-12", holiday: false},
+		{date: "2021-02-01", holiday: false},
+		{date: "2021-03-05", holiday: false},
+		{date: "2021-01-01", holiday: false}, // new year and gandhi memory day aren't exchange holidays
+		{date: "2024-01-30", holiday: false},
+	}
+
+	for _, test := range tests {
+		var d, _ = time.Parse("2006-01-02", test.date)
+		if got := Holiday(d); got != test.holiday {
+			t.Errorf("Holiday(%s) = %v; want %v", test.date, got, test.holiday)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// ClientOptions configures the http client used by the package (see NewClient)
+type ClientOptions struct {
+	Timeout        time.Duration // time limit for a request, including reading the response body; zero means no limit
+	ConnectTimeout time.Duration // time limit for establishing a connection (including tls handshake)
+
+	// Proxy is the url of the proxy to use, with http, https or socks5 scheme (like socks5://localhost:1080)
+	// If empty, the proxy is configured from the environment (HTTP_PROXY, HTTPS_PROXY and NO_PROXY)
+	Proxy string
+
+	// CACert is the path to a bundle of (pem encoded) certificates trusted in addition to the system's certificates
+	CACert string
+
+	KeepAlive         time.Duration // interval between tcp keep-alive probes; negative disables the probes
+	IdleConnTimeout   time.Duration // time an idle (keep-alive) connection remains open
+	DisableKeepAlives bool          // use a new connection for every request
+}
+
+// DefaultClientOptions returns the default options for the http client
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		Timeout:         2 * time.Minute,
+		ConnectTimeout:  30 * time.Second,
+		KeepAlive:       30 * time.Second,
+		IdleConnTimeout: 90 * time.Second,
+	}
+}
+
+// NewClient creates a new http client configured with the given options
+func NewClient(opts ClientOptions) (_ *http.Client, err error) {
+	var dialer = &net.Dialer{Timeout: opts.ConnectTimeout, KeepAlive: opts.KeepAlive}
+	var transport = &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		TLSHandshakeTimeout:   opts.ConnectTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		DisableKeepAlives:     opts.DisableKeepAlives,
+	}
+
+	if opts.Proxy != "" {
+		var proxy *url.URL
+		if proxy, err = url.Parse(opts.Proxy); err != nil {
+			return nil, errors.Wrapf(err, "invalid proxy url %q", opts.Proxy)
+		}
+
+		switch proxy.Scheme {
+		case "http", "https", "socks5", "socks5h":
+			transport.Proxy = http.ProxyURL(proxy)
+		default:
+			return nil, errors.Errorf("unsupported proxy scheme %q", proxy.Scheme)
+		}
+	}
+
+	if opts.CACert != "" {
+		var pem []byte
+		if pem, err = os.ReadFile(opts.CACert); err != nil {
+			return nil, errors.Wrapf(err, "failed to read ca certificates")
+		}
+
+		var pool, _ = x509.SystemCertPool()
+		if pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in %s", opts.CACert)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{Transport: transport, Timeout: opts.Timeout}, nil
+}
@@ -0,0 +1,219 @@
+package pipeline
+
+import (
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// get fetches the url with the client, returning the response body
+func get(client *http.Client, url string) (string, error) {
+	var response, err = client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	var body []byte
+	body, err = io.ReadAll(response.Body)
+	return string(body), err
+}
+
+func TestClientCACert(t *testing.T) {
+	var server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	var dir = t.TempDir()
+	var bundle = filepath.Join(dir, "ca.pem")
+	var cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, cert, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var opts = DefaultClientOptions()
+	var client, err = NewClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = get(client, server.URL); err == nil {
+		t.Errorf("expected server's certificate to be untrusted without the ca bundle")
+	}
+
+	opts.CACert = bundle
+	if client, err = NewClient(opts); err != nil {
+		t.Fatal(err)
+	}
+	if body, err := get(client, server.URL); err != nil || body != "ok" {
+		t.Errorf("expected server's certificate to be trusted with the ca bundle; got %q (%v)", body, err)
+	}
+
+	var empty = filepath.Join(dir, "empty.pem")
+	_ = os.WriteFile(empty, []byte("not a certificate"), 0644)
+	for file, expected := range map[string]string{empty: "no certificates found", filepath.Join(dir, "missing.pem"): "failed to read"} {
+		opts.CACert = file
+		if _, err = NewClient(opts); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error containing %q for %s; got %v", expected, file, err)
+		}
+	}
+}
+
+func TestClientInvalidProxy(t *testing.T) {
+	var tests = map[string]string{
+		"ftp://localhost:21": "unsupported proxy scheme",
+		"://localhost":       "invalid proxy url",
+	}
+
+	for proxy, expected := range tests {
+		var opts = DefaultClientOptions()
+		opts.Proxy = proxy
+		if _, err := NewClient(opts); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error containing %q for %q; got %v", expected, proxy, err)
+		}
+	}
+}
+
+func TestClientHttpProxy(t *testing.T) {
+	var proxy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "proxied "+r.URL.String()) // a proxy receives the absolute url
+	}))
+	defer proxy.Close()
+
+	var opts = DefaultClientOptions()
+	opts.Proxy = proxy.URL
+	var client, err = NewClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body, err := get(client, "http://reports.example/bhav.csv"); err != nil || body != "proxied http://reports.example/bhav.csv" {
+		t.Errorf("expected request to go through the proxy; got %q (%v)", body, err)
+	}
+}
+
+func TestClientSocksProxy(t *testing.T) {
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	for _, scheme := range []string{"socks5", "socks5h"} {
+		var proxy, targets = socks5(t, server.Listener.Addr().String())
+
+		var opts = DefaultClientOptions()
+		opts.Proxy = scheme + "://" + proxy
+		var client, err = NewClient(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if body, err := get(client, "http://reports.example/bhav.csv"); err != nil || body != "ok" {
+			t.Errorf("%s: expected request to go through the proxy; got %q (%v)", scheme, body, err)
+		} else if target := <-targets; target != "reports.example:80" {
+			t.Errorf("%s: expected the proxy to resolve the host; got %s", scheme, target)
+		}
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	var opts = DefaultClientOptions()
+	opts.Timeout = 50 * time.Millisecond
+	var client, err = NewClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ne net.Error
+	if _, err = get(client, server.URL); err == nil {
+		t.Fatalf("expected request to time out")
+	} else if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Errorf("expected a timeout error; got %v", err)
+	}
+}
+
+// socks5 starts a socks5 proxy (without authentication) that connects every request to the given address,
+// returning the address of the proxy and a channel receiving the targets (host:port) requested from it
+func socks5(t *testing.T, upstream string) (string, <-chan string) {
+	var listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	var targets = make(chan string, 1)
+	go func() {
+		for {
+			var conn, err = listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				var buf = make([]byte, 262)
+				// greeting: version, number of methods and the methods; accept "no authentication"
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+					return
+				}
+				_, _ = conn.Write([]byte{5, 0})
+
+				// request: version, command, reserved, address type, address and port
+				if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+					return
+				}
+
+				var host string
+				switch buf[3] {
+				case 1: // ipv4
+					_, _ = io.ReadFull(conn, buf[:4])
+					host = net.IP(buf[:4]).String()
+				case 3: // domain name
+					_, _ = io.ReadFull(conn, buf[:1])
+					var n = int(buf[0])
+					_, _ = io.ReadFull(conn, buf[:n])
+					host = string(buf[:n])
+				default:
+					return
+				}
+				_, _ = io.ReadFull(conn, buf[:2])
+				targets <- net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(buf[:2]))))
+
+				var up, err = net.Dial("tcp", upstream)
+				if err != nil {
+					_, _ = conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer up.Close()
+				_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+				go func() { _, _ = io.Copy(up, conn) }()
+				_, _ = io.Copy(conn, up)
+			}(conn)
+		}
+	}()
+
+	return listener.Addr().String(), targets
+}
@@ -0,0 +1,169 @@
+package pipeline
+
+import (
+	"bufio"
+	scsv "encoding/csv"
+	"fmt"
+	csv "github.com/jszwec/csvutil"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// RowError is a row of a report that couldn't be parsed. Parsers report such rows (see Parseable)
+// and carry on with the rest of the report, rather than dropping the whole report.
+type RowError struct {
+	Source string    // name of the source publishing the report (see Source)
+	Report string    // the report the row belongs to
+	Date   time.Time // date the report was published on
+	Header string    // header row of the report, verbatim; needed to parse the row again
+	Line   int       // line number of the row in the report (starting at 1, for the header)
+	Row    string    // the row, verbatim (as csv)
+	Err    error     // reason the row couldn't be parsed
+}
+
+func (e *RowError) Error() string { return fmt.Sprintf("line %d: %v", e.Line, e.Err) }
+func (e *RowError) Cause() error  { return e.Err }
+func (e *RowError) Unwrap() error { return e.Err }
+
+// maximum number of lines a (quoted) row can span; a row with unbalanced quotes is limited to its first line
+const maxRowLines = 8
+
+// rowReader reads the rows of a csv report, keeping track of the line number and the raw row.
+// Each row is parsed on its own, so that a malformed row doesn't affect the rows after it.
+// It implements csvutil.Reader, normalising the rows for the decoder.
+type rowReader struct {
+	reader  *bufio.Reader
+	pending []string // lines read ahead (while looking for the end of a quoted row)
+	header  int      // number of columns in the header; zero while reading the header
+	next    int      // line number of the next line
+	line    int      // line number of the last row read
+	raw     string   // last row read, verbatim (without the line terminator)
+	err     error    // error encountered while reading; reading can't continue after it
+}
+
+func newRowReader(r io.Reader) *rowReader { return &rowReader{reader: bufio.NewReader(r), next: 1} }
+
+// readLine returns the next line (without the line terminator)
+func (r *rowReader) readLine() (string, error) {
+	if len(r.pending) > 0 {
+		var line = r.pending[0]
+		r.pending = r.pending[1:]
+		return line, nil
+	}
+
+	var line, err = r.reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readRow returns the next (non-blank) row, joining lines of quoted fields spanning multiple lines
+func (r *rowReader) readRow() (_ string, err error) {
+	var lines []string
+	for {
+		var line string
+		if line, err = r.readLine(); err == io.EOF && len(lines) > 0 {
+			break // unterminated quoted field
+		} else if err != nil {
+			return "", err
+		}
+
+		if len(lines) == 0 && strings.TrimSpace(line) == "" { // skip blank lines
+			r.next++
+			continue
+		}
+
+		if lines = append(lines, line); strings.Count(strings.Join(lines, "\n"), `"`)%2 == 0 || len(lines) == maxRowLines {
+			break
+		}
+	}
+
+	if strings.Count(strings.Join(lines, "\n"), `"`)%2 != 0 { // unbalanced quotes; limit the row to its first line
+		r.pending, lines = append(lines[1:], r.pending...), lines[:1]
+	}
+
+	r.line, r.next = r.next, r.next+len(lines)
+	return strings.Join(lines, "\n"), nil
+}
+
+func (r *rowReader) Read() (_ []string, err error) {
+	if r.raw, err = r.readRow(); err != nil {
+		if err != io.EOF {
+			r.err = err
+		}
+		return nil, err
+	}
+
+	var reader = scsv.NewReader(strings.NewReader(r.raw))
+	reader.FieldsPerRecord = -1 // rows are checked against the header by the decoder
+
+	var record []string
+	if record, err = reader.Read(); err != nil {
+		var pe *scsv.ParseError
+		if errors.As(err, &pe) {
+			err = pe.Err // line and column in the error are relative to the row
+		}
+		return nil, err
+	}
+
+	for i := range record {
+		record[i] = strings.TrimSpace(record[i])
+	}
+
+	// drop trailing blank columns not present in the header (like NSE's trailing comma)
+	for r.header > 0 && len(record) > r.header && record[len(record)-1] == "" {
+		record = record[:len(record)-1]
+	}
+
+	return record, nil
+}
+
+// decodeReport decodes the rows of a csv report using a new record (returned by record) for each row, calling fn for
+// each row decoded and bad for each row that couldn't be decoded. The header row is normalised (byte order mark and
+// surrounding spaces removed, upper-cased) before matching it against the record's fields.
+func decodeReport(r io.Reader, record func() Equity, fn func(Equity) error, bad func(*RowError) error) (err error) {
+	var reader = newRowReader(r)
+
+	var header []string
+	if header, err = reader.Read(); err == io.EOF {
+		return errors.New("empty report")
+	} else if err != nil {
+		return errors.Wrap(err, "failed to read header")
+	}
+
+	for i := range header {
+		if header[i] = uc(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))); header[i] == "" {
+			header[i] = fmt.Sprintf("_%d", i) // blank (trailing) column
+		}
+	}
+	reader.header = len(header)
+	var rawHeader = reader.raw
+
+	var decoder *csv.Decoder
+	if decoder, err = csv.NewDecoder(reader, header...); err != nil {
+		return errors.Wrap(err, "failed to read header")
+	}
+
+	for {
+		var eq = record()
+		if err = decoder.Decode(eq); err == io.EOF {
+			return nil
+		} else if reader.err != nil {
+			return reader.err
+		} else if err != nil {
+			if err = bad(&RowError{Header: rawHeader, Line: reader.line, Row: reader.raw, Err: err}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err = fn(eq); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package pipeline
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// parsers by the prefix of the report's file name in testdata/reports
+var parsers = map[string]func(io.Reader, time.Time, func(Equity) error, func(*RowError) error) error{
+	"bse": parseBseEquity,
+	"nse": parseNseEquity,
+}
+
+// describe parses the report and describes the records and row errors, one per line
+func describe(parse func(io.Reader, time.Time, func(Equity) error, func(*RowError) error) error, r io.Reader) string {
+	var b strings.Builder
+	var err = parse(r, day1, func(eq Equity) error {
+		var o, h, l, c = eq.OHLC()
+		_, _ = fmt.Fprintf(&b, "%s %s %s %s %s ohlc=%v/%v/%v/%v last=%v prev=%v volume=%d\n", eq.Exchange(), eq.TradingDate().Format("2006-01-02"),
+			eq.Ticker(), eq.Type(), eq.ISIN(), o, h, l, c, eq.Last(), eq.PrevClose(), eq.Volume())
+		return nil
+	}, func(e *RowError) error {
+		_, _ = fmt.Fprintf(&b, "error: %v\n  row: %s\n", e, e.Row)
+		return nil
+	})
+
+	if err != nil {
+		_, _ = fmt.Fprintf(&b, "failed: %v\n", err)
+	}
+	return b.String()
+}
+
+// TestParsersGolden parses each report in testdata/reports and compares the outcome with the golden file
+// Run with -update to (re-)generate the golden files.
+func TestParsersGolden(t *testing.T) {
+	var files, _ = filepath.Glob(filepath.Join("testdata", "reports", "*.csv"))
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			var parse = parsers[strings.SplitN(filepath.Base(file), "_", 2)[0]]
+
+			var data, err = os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var actual = describe(parse, bytes.NewReader(data))
+			var golden = strings.TrimSuffix(file, ".csv") + ".golden"
+			if *update {
+				if err = os.WriteFile(golden, []byte(actual), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var expected []byte
+			if expected, err = os.ReadFile(golden); err != nil {
+				t.Fatal(err)
+			}
+
+			if actual != string(expected) {
+				t.Errorf("outcome differs from %s\n--- expected\n%s\n--- actual\n%s", golden, expected, actual)
+			}
+		})
+	}
+}
+
+// fuzz runs the parser on arbitrary input, checking that it never panics and that every row is accounted for
+func fuzz(f *testing.F, prefix string) {
+	var files, _ = filepath.Glob(filepath.Join("testdata", "reports", prefix+"_*.csv"))
+	for _, file := range files {
+		var data, _ = os.ReadFile(file)
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var records, errors int
+		var err = parsers[prefix](bytes.NewReader(data), day1, func(eq Equity) error {
+			records++
+			_, _, _, _ = eq.OHLC()
+			_, _ = eq.Ticker(), eq.ISIN()
+			return nil
+		}, func(e *RowError) error {
+			if e.Err == nil || e.Line < 1 {
+				t.Errorf("invalid row error: %#v", e)
+			}
+			errors++
+			return nil
+		})
+
+		// a report can have at most as many rows as lines (excluding the header)
+		if lines := bytes.Count(data, []byte("\n")) + 1; err == nil && records+errors > lines-1 {
+			t.Errorf("%d records and %d errors from %d lines", records, errors, lines)
+		}
+	})
+}
+
+func FuzzParseBseEquity(f *testing.F) { fuzz(f, "bse") }
+func FuzzParseNseEquity(f *testing.F) { fuzz(f, "nse") }
+
+func FuzzCsvDate(f *testing.F) {
+	for _, seed := range []string{"05-MAR-2021", "5-Mar-2021", " 05-mar-2021 ", "2021-03-05", "", "31-FEB-2021"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		var d csvDate
+		if err := d.UnmarshalCSV([]byte(s)); err != nil {
+			return
+		}
+
+		// a parsed date must survive a round-trip through the format used by the exchange
+		var again csvDate
+		if err := again.UnmarshalCSV([]byte(uc(d.Format("02-Jan-2006")))); err != nil || !again.Equal(d.Time) {
+			t.Errorf("%q parsed as %s, which doesn't round-trip: %v", s, d.Time, err)
+		}
+	})
+}
@@ -0,0 +1,157 @@
+// Package fake provides a fake exchange server, serving bhavcopies (and landing pages) the way BSE and NSE do,
+// to test the pipeline without making requests to the exchanges.
+package fake
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NseLanding is the path of NSE's landing page (which sets the session cookie)
+const NseLanding = "/products/content/equities/equities/archieve_eq.htm"
+
+// name of the cookie set by nse's landing page
+const nseCookie = "nsit"
+
+var (
+	reBse = regexp.MustCompile(`^/download/BhavCopy/Equity/EQ(\d{6})_csv\.zip$`)
+	reNse = regexp.MustCompile(`^/content/historical/EQUITIES/\d{4}/[A-Z]{3}/cm(\d{2}[A-Z]{3}\d{4})bhav\.csv\.zip$`)
+)
+
+// Exchange is a http.Handler serving the bhavcopies added to it. Requests for dates with no bhavcopy
+// are answered with 404. Like NSE's website, requests for NSE's bhavcopies must carry the cookie
+// set by the landing page, or they are rejected with 403.
+type Exchange struct {
+	sync.Mutex
+	bse      map[string][]byte // zip archives by date (as in the url)
+	nse      map[string][]byte // zip archives by date (as in the url)
+	session  string            // value of the current session cookie
+	sessions int               // number of sessions started
+
+	Requests []string // paths requested from the exchange, in order
+}
+
+// NewExchange creates a new exchange with no bhavcopies
+func NewExchange() *Exchange {
+	return &Exchange{bse: make(map[string][]byte), nse: make(map[string][]byte)}
+}
+
+// AddBse adds a bhavcopy (the csv report) published by BSE on the given date
+func (e *Exchange) AddBse(date time.Time, report string) {
+	e.Lock()
+	defer e.Unlock()
+	e.bse[date.Format("020106")] = archive("EQ"+date.Format("020106")+".CSV", report)
+}
+
+// AddNse adds a bhavcopy (the csv report) published by NSE on the given date
+func (e *Exchange) AddNse(date time.Time, report string) {
+	e.Lock()
+	defer e.Unlock()
+	var d = strings.ToUpper(date.Format("02Jan2006"))
+	e.nse[d] = archive("cm"+d+"bhav.csv", report)
+}
+
+// ExpireSession invalidates the current session cookie, as if NSE expired the session
+func (e *Exchange) ExpireSession() {
+	e.Lock()
+	defer e.Unlock()
+	e.session = ""
+}
+
+// Sessions returns the number of sessions started (i.e. visits to the landing page)
+func (e *Exchange) Sessions() int {
+	e.Lock()
+	defer e.Unlock()
+	return e.sessions
+}
+
+func (e *Exchange) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.Lock()
+	defer e.Unlock()
+	e.Requests = append(e.Requests, r.URL.Path)
+
+	if r.URL.Path == NseLanding {
+		e.sessions++
+		e.session = fmt.Sprintf("session-%d", e.sessions)
+		http.SetCookie(w, &http.Cookie{Name: nseCookie, Value: e.session, Path: "/"})
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<!DOCTYPE html><html><body>archives</body></html>"))
+		return
+	}
+
+	if m := reBse.FindStringSubmatch(r.URL.Path); m != nil {
+		serve(w, e.bse[m[1]])
+		return
+	}
+
+	if m := reNse.FindStringSubmatch(r.URL.Path); m != nil {
+		if c, err := r.Cookie(nseCookie); err != nil || e.session == "" || c.Value != e.session {
+			http.Error(w, "access denied", http.StatusForbidden)
+			return
+		}
+		serve(w, e.nse[m[1]])
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// serve writes the zip archive to the response (or a 404 error page if the archive is nil)
+func serve(w http.ResponseWriter, archive []byte) {
+	if archive == nil {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("<html><body>The resource you are looking for has been removed</body></html>"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-zip-compressed")
+	_, _ = w.Write(archive)
+}
+
+// archive creates a zip archive with a single file
+func archive(name, content string) []byte {
+	var buf bytes.Buffer
+	var zw = zip.NewWriter(&buf)
+	var w, _ = zw.Create(name)
+	_, _ = w.Write([]byte(content))
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+// Server is a fake exchange listening on a local address
+type Server struct {
+	*Exchange
+	*httptest.Server
+}
+
+// NewServer starts a new server for a new (empty) exchange. The server must be closed after use.
+func NewServer() *Server {
+	var exchange = NewExchange()
+	return &Server{Exchange: exchange, Server: httptest.NewServer(exchange)}
+}
+
+// Client returns a http client that sends all requests to the server, irrespective of the host in the url.
+// It can be used as pipeline.Client to redirect requests meant for the exchanges to the server.
+func (s *Server) Client() *http.Client {
+	var target, _ = url.Parse(s.URL)
+	var transport = s.Server.Client().Transport
+	return &http.Client{Transport: roundTripper(func(r *http.Request) (*http.Response, error) {
+		r = r.Clone(r.Context())
+		r.URL.Scheme, r.URL.Host = target.Scheme, target.Host
+		return transport.RoundTrip(r)
+	})}
+}
+
+// roundTripper is an adapter to use ordinary functions as http.RoundTripper
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
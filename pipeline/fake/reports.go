@@ -0,0 +1,35 @@
+package fake
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BseReport returns a sample bhavcopy (in the format published by BSE) for the given date
+// with rows for INFY (500209) and TCS (532540). Prices are derived from the day of month.
+func BseReport(date time.Time) string {
+	var b strings.Builder
+	b.WriteString("SC_CODE,SC_NAME,SC_GROUP,SC_TYPE,OPEN,HIGH,LOW,CLOSE,LAST,PREVCLOSE,NO_TRADES,NO_OF_SHRS,NET_TURNOV,TDCLOINDI,ISIN_CODE\n")
+
+	var d = float64(date.Day())
+	_, _ = fmt.Fprintf(&b, "500209,INFOSYS LTD.,A ,Q,%.2f,%.2f,%.2f,%.2f,%.2f,%.2f,100,1000,1350000,,INE009A01021\n",
+		1300+d, 1310+d, 1290+d, 1305+d, 1305+d, 1304+d)
+	_, _ = fmt.Fprintf(&b, "532540,TATA CONSULTANCY SERVICES LTD.,A ,Q,%.2f,%.2f,%.2f,%.2f,%.2f,%.2f,200,2000,6000000,,INE467B01029\n",
+		3000+d, 3010+d, 2990+d, 3005+d, 3005+d, 3004+d)
+	return b.String()
+}
+
+// NseReport returns a sample bhavcopy (in the format published by NSE) for the given date
+// with rows for INFY and TCS. Prices are derived from the day of month. Like NSE's reports, rows end with a comma.
+func NseReport(date time.Time) string {
+	var b strings.Builder
+	b.WriteString("SYMBOL,SERIES,OPEN,HIGH,LOW,CLOSE,LAST,PREVCLOSE,TOTTRDQTY,TOTTRDVAL,TIMESTAMP,TOTALTRADES,ISIN,\n")
+
+	var d, ts = float64(date.Day()), strings.ToUpper(date.Format("02-Jan-2006"))
+	_, _ = fmt.Fprintf(&b, "INFY,EQ,%.2f,%.2f,%.2f,%.2f,%.2f,%.2f,5000,6750000,%s,500,INE009A01021,\n",
+		1300+d, 1310+d, 1290+d, 1305+d, 1305+d, 1304+d, ts)
+	_, _ = fmt.Fprintf(&b, "TCS,EQ,%.2f,%.2f,%.2f,%.2f,%.2f,%.2f,4000,12000000,%s,400,INE467B01029,\n",
+		3000+d, 3010+d, 2990+d, 3005+d, 3005+d, 3004+d, ts)
+	return b.String()
+}
@@ -0,0 +1,204 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// FetchError is returned when a resource cannot be fetched (or the response is not a valid report).
+// It carries the context of the request and response to help diagnose the failure.
+type FetchError struct {
+	URL         string // url of the resource
+	Status      int    // http status code; zero if no response was received
+	ContentType string // content type of the response, as reported by the server
+	Size        int64  // size of the response body; zero if not read
+	Err         error  // underlying cause
+}
+
+func (e *FetchError) Error() string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "failed to fetch %q", e.URL)
+	if e.Status != 0 {
+		_, _ = fmt.Fprintf(&b, " (status=%d content-type=%q size=%d)", e.Status, e.ContentType, e.Size)
+	}
+	_, _ = fmt.Fprintf(&b, ": %v", e.Err)
+	return b.String()
+}
+
+func (e *FetchError) Cause() error  { return e.Err }
+func (e *FetchError) Unwrap() error { return e.Err }
+
+// content types the exchanges are known to serve reports with; an empty content type is accepted too
+var acceptedContentTypes = map[string]bool{
+	"application/zip":              true,
+	"application/x-zip-compressed": true,
+	"application/x-zip":            true,
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/octet-stream":     true,
+	"application/vnd.ms-excel":     true,
+	"application/csv":              true,
+	"text/csv":                     true,
+	"text/plain":                   true,
+}
+
+// exchanges serve error (and captcha / maintenance) pages with status 200
+var errHtmlPage = errors.New("server returned an html page instead of the report")
+
+// formats of the report
+const (
+	formatPlain = "plain" // plain text (csv)
+	formatZip   = "zip"
+	formatGzip  = "gzip"
+)
+
+// doer sends http requests; implemented by http.Client and Session
+type doer interface {
+	Do(request *http.Request) (*http.Response, error)
+}
+
+// report is a downloaded report, spooled to a temporary file
+type report struct {
+	url    string
+	file   *os.File  // temporary file the response is spooled to
+	size   int64     // size of the spooled response
+	format string    // format of the report; see format* constants
+	member *zip.File // member of the archive containing the report (if format is zip)
+}
+
+// fetch performs the request (using client) and spools the response to a temporary file. It validates the response
+// (status, content type and that it is not an html page) and detects the format of the report.
+// If the response is a zip archive, the report is the (case-insensitively matched) member of the archive,
+// or the only file in the archive if member is empty. The returned report must be closed after use.
+func fetch(client doer, request *http.Request, member string) (_ *report, err error) {
+	var endpoint = request.URL.String()
+
+	var response *http.Response
+	if response, err = client.Do(request); err != nil {
+		return nil, &FetchError{URL: endpoint, Err: err}
+	}
+	defer response.Body.Close()
+
+	var contentType = response.Header.Get("Content-Type")
+	var fail = func(size int64, err error) error {
+		return &FetchError{URL: endpoint, Status: response.StatusCode, ContentType: contentType, Size: size, Err: err}
+	}
+
+	if status := response.StatusCode; status != http.StatusOK {
+		return nil, fail(0, errors.Errorf("server returned %d", status))
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "text/html" {
+		return nil, fail(0, errHtmlPage)
+	} else if contentType != "" && !acceptedContentTypes[mediaType] {
+		return nil, fail(0, errors.Errorf("unexpected content type %q", mediaType))
+	}
+
+	var r = &report{url: endpoint}
+	if r.file, r.size, err = spool(response.Body); err != nil { // zip needs to be seek-able; spool response to a temporary file
+		return nil, fail(0, errors.Wrap(err, "failed to read response"))
+	}
+
+	var head = make([]byte, 512)
+	var n, _ = r.file.ReadAt(head, 0)
+	head = head[:n]
+
+	switch {
+	case r.size == 0:
+		err = errors.New("empty response")
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		r.format = formatZip
+		err = r.locate(member)
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		r.format = formatGzip
+	case isHTML(head):
+		err = errHtmlPage
+	default:
+		r.format = formatPlain
+	}
+
+	if err != nil {
+		_ = r.Close()
+		return nil, fail(r.size, err)
+	}
+
+	return r, nil
+}
+
+// locate finds the member in the zip archive
+func (r *report) locate(member string) (err error) {
+	var archive *zip.Reader
+	if archive, err = zip.NewReader(r.file, r.size); err != nil {
+		return errors.Wrap(err, "failed to unzip response")
+	}
+
+	if member == "" {
+		if len(archive.File) != 1 {
+			return errors.Errorf("expected a single file in archive; found %d", len(archive.File))
+		}
+		r.member = archive.File[0]
+		return nil
+	}
+
+	for _, file := range archive.File {
+		if strings.EqualFold(file.Name, member) {
+			r.member = file
+			return nil
+		}
+	}
+
+	var names []string
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	return errors.Errorf("file %s not found in archive (found %s)", member, strings.Join(names, ", "))
+}
+
+// Open opens the (decompressed) report for reading
+func (r *report) Open() (_ io.ReadCloser, err error) {
+	switch r.format {
+	case formatZip:
+		var rc io.ReadCloser
+		if rc, err = r.member.Open(); err != nil {
+			return nil, errors.Wrapf(err, "failed to open file %s", r.member.Name)
+		}
+		return rc, nil
+	case formatGzip:
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(io.NewSectionReader(r.file, 0, r.size)); err != nil {
+			return nil, errors.Wrap(err, "failed to decompress response")
+		}
+		return gz, nil
+	default:
+		return io.NopCloser(io.NewSectionReader(r.file, 0, r.size)), nil
+	}
+}
+
+// String returns the url of the report (and the name of the member, if the report is in a zip archive)
+func (r *report) String() string {
+	if r.member != nil {
+		return r.url + "#" + r.member.Name
+	}
+	return r.url
+}
+
+// Close releases the temporary file holding the report
+func (r *report) Close() error { return release(r.file) }
+
+// isHTML returns true if the content looks like an html document
+func isHTML(head []byte) bool {
+	if strings.HasPrefix(http.DetectContentType(head), "text/html") {
+		return true
+	}
+
+	var s = strings.ToLower(string(bytes.TrimSpace(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")))))
+	return strings.HasPrefix(s, "<!doctype") || strings.HasPrefix(s, "<html") || strings.HasPrefix(s, "<?xml")
+}
@@ -0,0 +1,171 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"go.riyazali.net/bhav/pipeline/fake"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetch(t *testing.T) {
+	var report = fake.NseReport(day1)
+
+	var zipped bytes.Buffer
+	var zw = zip.NewWriter(&zipped)
+	var w, _ = zw.Create("CM05MAR2021BHAV.CSV") // differently cased than the expected member
+	_, _ = w.Write([]byte(report))
+	_ = zw.Close()
+
+	var gzipped bytes.Buffer
+	var gw = gzip.NewWriter(&gzipped)
+	_, _ = gw.Write([]byte(report))
+	_ = gw.Close()
+
+	var tests = []struct {
+		name        string
+		contentType string
+		body        []byte
+		err         string // expected error; empty if fetch must succeed
+	}{
+		{name: "zip", contentType: "application/zip", body: zipped.Bytes()},
+		{name: "gzip", contentType: "application/gzip", body: gzipped.Bytes()},
+		{name: "plain", contentType: "text/csv", body: []byte(report)},
+		{name: "no content type", body: []byte(report)},
+		{name: "html content type", contentType: "text/html; charset=utf-8", body: []byte("<html></html>"), err: "html page"},
+		{name: "html page", contentType: "application/octet-stream", body: []byte("\n <!DOCTYPE html><html></html>"), err: "html page"},
+		{name: "unexpected content type", contentType: "image/png", body: []byte(report), err: "unexpected content type"},
+		{name: "empty", contentType: "application/zip", err: "empty response"},
+		{name: "corrupt zip", contentType: "application/zip", body: []byte("PK\x03\x04garbage"), err: "failed to unzip"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header()["Content-Type"] = []string{test.contentType}
+				_, _ = w.Write(test.body)
+			}))
+			defer server.Close()
+
+			var request, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+			var r, err = fetch(server.Client(), request, "cm05MAR2021bhav.csv")
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q; got %v", test.err, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			var n int
+			var data = &sourceData{source: &Source{Parse: parseNseEquity}, date: day1, report: r}
+			if err = data.Parse(func(Equity) error { n++; return nil }, func(e *RowError) error { return e }); err != nil {
+				t.Fatal(err)
+			}
+
+			if n != 2 {
+				t.Errorf("expected 2 records; got %d", n)
+			}
+		})
+	}
+}
+
+func TestFetchMissingMember(t *testing.T) {
+	var zipped bytes.Buffer
+	var zw = zip.NewWriter(&zipped)
+	_, _ = zw.Create("a.csv")
+	_, _ = zw.Create("b.csv")
+	_ = zw.Close()
+
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(zipped.Bytes())
+	}))
+	defer server.Close()
+
+	for member, expected := range map[string]string{"c.csv": "not found in archive (found a.csv, b.csv)", "": "expected a single file"} {
+		var request, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+		if _, err := fetch(server.Client(), request, member); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error containing %q; got %v", expected, err)
+		}
+	}
+}
+
+func TestFetchSingleMember(t *testing.T) {
+	var zipped bytes.Buffer
+	var zw = zip.NewWriter(&zipped)
+	var w, _ = zw.Create("EQ050321.CSV")
+	_, _ = w.Write([]byte(fake.BseReport(day1)))
+	_ = zw.Close()
+
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-zip-compressed")
+		_, _ = w.Write(zipped.Bytes())
+	}))
+	defer server.Close()
+
+	var request, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+	var r, err = fetch(server.Client(), request, "") // any name, as the archive has a single file
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if r.format != formatZip || r.String() != server.URL+"#EQ050321.CSV" {
+		t.Errorf("expected the only member of the archive; got %s (%s)", r, r.format)
+	}
+}
+
+func TestFetchError(t *testing.T) {
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	var request, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+	var _, err = fetch(server.Client(), request, "")
+
+	var fe *FetchError
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected a FetchError; got %v", err)
+	}
+	if fe.URL != server.URL || fe.Status != http.StatusNotFound || fe.ContentType != "text/plain" {
+		t.Errorf("unexpected error context %+v", fe)
+	}
+	if !strings.Contains(err.Error(), "server returned 404") {
+		t.Errorf("expected the status in the error; got %v", err)
+	}
+
+	server.Close() // no response
+	if _, err = fetch(server.Client(), request, ""); !errors.As(err, &fe) || fe.Status != 0 {
+		t.Errorf("expected a FetchError without status; got %v", err)
+	}
+}
+
+func TestIsHTML(t *testing.T) {
+	var tests = []struct {
+		head string
+		html bool
+	}{
+		{head: "<!DOCTYPE html><html><body>maintenance</body></html>", html: true},
+		{head: "\xef\xbb\xbf  <html>", html: true},
+		{head: "\n\n<HTML><HEAD>", html: true},
+		{head: `<?xml version="1.0"?><Error>AccessDenied</Error>`, html: true},
+		{head: "<head><title>captcha</title></head>", html: true},
+		{head: "SYMBOL,SERIES,OPEN,HIGH,LOW,CLOSE", html: false},
+		{head: "\xef\xbb\xbfSC_CODE,SC_NAME", html: false},
+		{head: "", html: false},
+	}
+
+	for _, test := range tests {
+		if got := isHTML([]byte(test.head)); got != test.html {
+			t.Errorf("isHTML(%q) = %v; want %v", test.head, got, test.html)
+		}
+	}
+}
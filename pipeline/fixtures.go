@@ -0,0 +1,96 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RecordingTransport is a http.RoundTripper that saves the responses it receives as fixture files in Dir,
+// to be served later by a ReplayTransport. Each response is saved (as a http/1.1 response dump) to a file
+// named after the request's url (see FixturePath).
+type RecordingTransport struct {
+	Dir       string
+	Transport http.RoundTripper // transport used to send the requests; http.DefaultTransport if nil
+}
+
+func (t *RecordingTransport) RoundTrip(request *http.Request) (_ *http.Response, err error) {
+	var transport = t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	var response *http.Response
+	if response, err = transport.RoundTrip(request); err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	body, err = io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// the transport decompresses the body (and drops the header) if it requested gzip-ed content itself
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	response.ContentLength, response.TransferEncoding = int64(len(body)), nil
+
+	var dump []byte
+	if dump, err = httputil.DumpResponse(response, true); err != nil {
+		return nil, err
+	}
+
+	var path = FixturePath(t.Dir, request.URL)
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create fixture directory")
+	}
+
+	if err = os.WriteFile(path, dump, 0644); err != nil {
+		return nil, errors.Wrapf(err, "failed to write fixture %s", path)
+	}
+
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	return response, nil
+}
+
+// ReplayTransport is a http.RoundTripper that serves the responses saved as fixture files in Dir
+// (by a RecordingTransport). It returns an error for requests with no saved response.
+type ReplayTransport struct{ Dir string }
+
+func (t *ReplayTransport) RoundTrip(request *http.Request) (_ *http.Response, err error) {
+	var path = FixturePath(t.Dir, request.URL)
+
+	var dump []byte
+	if dump, err = os.ReadFile(path); err != nil {
+		return nil, errors.Wrapf(err, "no fixture for %s", request.URL)
+	}
+
+	var response *http.Response
+	if response, err = http.ReadResponse(bufio.NewReader(bytes.NewReader(dump)), request); err != nil {
+		return nil, errors.Wrapf(err, "failed to read fixture %s", path)
+	}
+	return response, nil
+}
+
+// FixturePath returns the path of the fixture file (in dir) for the given url,
+// like dir/www.bseindia.com/download/BhavCopy/Equity/EQ050321_csv.zip.http
+func FixturePath(dir string, u *url.URL) string {
+	var name = u.Path
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += "index"
+	}
+
+	if u.RawQuery != "" {
+		name += "_" + url.QueryEscape(u.RawQuery)
+	}
+
+	return filepath.Join(dir, u.Host, filepath.FromSlash(name)) + ".http"
+}
@@ -0,0 +1,58 @@
+package pipeline
+
+import (
+	"go.riyazali.net/bhav/pipeline/fake"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var server = serve(t)
+	server.AddBse(day1, fake.BseReport(day1))
+	server.AddNse(day1, fake.NseReport(day1))
+
+	var dir = t.TempDir()
+	Client = &http.Client{Transport: &RecordingTransport{Dir: dir, Transport: Client.Transport}}
+
+	var recorded = make(map[string][]Equity)
+	for _, name := range []string{"bse/equity", "nse/equity"} {
+		var err error
+		if recorded[name], err = fetchAll(t, name, day1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var source, _ = Lookup("bse/equity")
+	var resource = source.Resource(day1).(*sourceResource)
+	var request, _ = http.NewRequest(http.MethodGet, resource.String(), nil)
+	if _, err := os.Stat(FixturePath(dir, request.URL)); err != nil {
+		t.Fatalf("expected fixture to be recorded: %v", err)
+	}
+
+	server.Close() // make sure nothing reaches the server
+	Client = &http.Client{Transport: &ReplayTransport{Dir: dir}}
+
+	for name, expected := range recorded {
+		var replayed, err = fetchAll(t, name, day1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(replayed) != len(expected) {
+			t.Fatalf("%s: expected %d records; got %d", name, len(expected), len(replayed))
+		}
+
+		for i := range expected {
+			var _, _, _, c1 = expected[i].OHLC()
+			var _, _, _, c2 = replayed[i].OHLC()
+			if expected[i].Ticker() != replayed[i].Ticker() || c1 != c2 {
+				t.Errorf("%s: record %d differs: %s %v != %s %v", name, i, expected[i].Ticker(), c1, replayed[i].Ticker(), c2)
+			}
+		}
+	}
+
+	if _, err := fetchAll(t, "bse/equity", day1.AddDate(0, 0, 1)); err == nil {
+		t.Error("expected error for request with no fixture")
+	}
+}
@@ -0,0 +1,46 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"strings"
+	"testing"
+)
+
+func TestLogFields(t *testing.T) {
+	serve(t) // nothing is published; downloads must fail
+
+	var buf bytes.Buffer
+	var logger = log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = logger }()
+
+	var source, _ = Lookup("nse/equity")
+	var opts = SyncOptions{Options: DefaultOptions(), Jobs: []Job{{Source: source, From: day1, To: day1}}}
+	opts.Sink = SinkFunc(func([]Equity) error { return nil })
+	if _, err := Sync(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+
+		if event["message"] == "failed to download resource" {
+			found = true
+			if event["exchange"] != "nse" || event["date"] != "2021-03-05" || !strings.Contains(event["resource"].(string), "cm05MAR2021bhav") {
+				t.Errorf("expected exchange, date and resource fields; got %v", event)
+			}
+		}
+	}
+
+	if !found {
+		t.Errorf("expected download failure to be logged; got %s", buf.String())
+	}
+}
@@ -0,0 +1,142 @@
+package pipeline
+
+import (
+	"bytes"
+	scsv "encoding/csv"
+	csv "github.com/jszwec/csvutil"
+	"github.com/pkg/errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kinds of corporate actions that affect a security's price
+const (
+	ActionSplit    = "split"
+	ActionBonus    = "bonus"
+	ActionDividend = "dividend"
+	ActionRights   = "rights"
+)
+
+// CorporateAction is an action (split, bonus, dividend or rights issue) taken by a company
+// that affects the price of its security on and after the ex-date.
+//
+// The meaning of Old, New and Amount depends on the kind of action:
+//   - split: face value changed from Old to New
+//   - bonus: New bonus shares issued for every Old shares held
+//   - dividend: Amount paid per share
+//   - rights: New shares offered for every Old shares held at Amount per share
+type CorporateAction struct {
+	Exchange string
+	Ticker   string
+	ExDate   time.Time
+	Kind     string
+	Old, New float64
+	Amount   float64
+	Purpose  string // purpose of the action as published by the exchange
+}
+
+// regular expressions used to parse the purpose of an action published by nse
+var (
+	reSplit    = regexp.MustCompile(`(?i)split.*?r[se]\.?\s*([\d.]+).*?r[se]\.?\s*([\d.]+)`)
+	reBonus    = regexp.MustCompile(`(?i)bonus\D*(\d+)\s*:\s*(\d+)`)
+	reDividend = regexp.MustCompile(`(?i)\bdiv(?:idend)?\b[^/]*?r[se]\.?\s*([\d.]+)`)
+	reRights   = regexp.MustCompile(`(?i)rights\D*(\d+)\s*:\s*(\d+)(?:.*?(premium))?(?:.*?r[se]\.?\s*([\d.]+))?`)
+)
+
+// ParseCorporateActionPurpose parses the purpose of a corporate action (as published by the exchange) into
+// a list of actions affecting the security's price. The returned actions only have Kind, Old, New and Amount set.
+// Purposes that don't affect price (like AGMs) return an empty list.
+func ParseCorporateActionPurpose(purpose string, faceValue float64) []CorporateAction {
+	var actions []CorporateAction
+	var num = func(s string) float64 { f, _ := strconv.ParseFloat(strings.TrimSuffix(s, "."), 64); return f }
+
+	if m := reSplit.FindStringSubmatch(purpose); m != nil && num(m[1]) > 0 && num(m[2]) > 0 {
+		actions = append(actions, CorporateAction{Kind: ActionSplit, Old: num(m[1]), New: num(m[2])})
+	}
+
+	if m := reBonus.FindStringSubmatch(purpose); m != nil && num(m[1]) > 0 && num(m[2]) > 0 {
+		actions = append(actions, CorporateAction{Kind: ActionBonus, New: num(m[1]), Old: num(m[2])})
+	}
+
+	if m := reRights.FindStringSubmatch(purpose); m != nil && num(m[1]) > 0 && num(m[2]) > 0 {
+		var price = num(m[4])
+		if m[3] != "" { // issued at a premium over face value
+			price += faceValue
+		}
+		actions = append(actions, CorporateAction{Kind: ActionRights, New: num(m[1]), Old: num(m[2]), Amount: price})
+	}
+
+	// a single action might declare multiple dividends (e.g. "interim dividend rs 2 / special dividend rs 3")
+	var dividend float64
+	for _, m := range reDividend.FindAllStringSubmatch(purpose, -1) {
+		dividend += num(m[1])
+	}
+	if dividend > 0 {
+		actions = append(actions, CorporateAction{Kind: ActionDividend, Amount: dividend})
+	}
+
+	return actions
+}
+
+// nse's corporate action csv record
+type nseCorporateAction struct {
+	Symbol    string `csv:"SYMBOL"`
+	Series    string `csv:"SERIES"`
+	Purpose   string `csv:"PURPOSE"`
+	FaceValue string `csv:"FACE VALUE"`
+	ExDate    string `csv:"EX-DATE"`
+}
+
+// ReadNseCorporateActions reads the list of corporate actions exported from nse's website (as csv)
+// and returns the actions that affect the price of a security.
+func ReadNseCorporateActions(r io.Reader) (_ []CorporateAction, err error) {
+	var data []byte
+	if data, err = io.ReadAll(r); err != nil {
+		return nil, errors.Wrapf(err, "failed to read corporate actions")
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // nse's export contains a byte-order mark
+
+	var reader = scsv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+
+	// header names in nse's export contain extra whitespace; normalize them before decoding
+	var header []string
+	if header, err = reader.Read(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read header")
+	}
+	for i := range header {
+		header[i] = uc(strings.TrimSpace(header[i]))
+	}
+
+	var decoder *csv.Decoder
+	if decoder, err = csv.NewDecoder(reader, header...); err != nil {
+		return nil, err
+	}
+
+	var actions []CorporateAction
+	for {
+		var record nseCorporateAction
+		if err = decoder.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "failed to read row from csv")
+		}
+
+		var exDate csvDate
+		if exDate.UnmarshalCSV([]byte(strings.TrimSpace(record.ExDate))) != nil {
+			continue // actions without an ex-date (published as "-") don't affect the price
+		}
+
+		var faceValue, _ = strconv.ParseFloat(strings.TrimSpace(record.FaceValue), 64)
+		for _, action := range ParseCorporateActionPurpose(record.Purpose, faceValue) {
+			action.Exchange, action.Ticker = "nse", strings.TrimSpace(record.Symbol)
+			action.ExDate, action.Purpose = exDate.Time, strings.TrimSpace(record.Purpose)
+			actions = append(actions, action)
+		}
+	}
+
+	return actions, nil
+}
@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCorporateActionPurpose(t *testing.T) {
+	var tests = []struct {
+		purpose   string
+		faceValue float64
+		actions   []CorporateAction
+	}{
+		{purpose: "Face Value Split (Sub-Division) - From Rs 10/- Per Share To Rs 2/- Per Share", faceValue: 10,
+			actions: []CorporateAction{{Kind: ActionSplit, Old: 10, New: 2}}},
+		{purpose: "Face Value Split (Sub-Division) - From Rs 10/- Per Share To Re 1/- Per Share", faceValue: 10,
+			actions: []CorporateAction{{Kind: ActionSplit, Old: 10, New: 1}}},
+		{purpose: "Face Value Split (Sub-Division) - From Rs.5/- Per Share To Re.1/- Per Share", faceValue: 5,
+			actions: []CorporateAction{{Kind: ActionSplit, Old: 5, New: 1}}},
+		{purpose: "Bonus 1:1", faceValue: 5,
+			actions: []CorporateAction{{Kind: ActionBonus, New: 1, Old: 1}}},
+		{purpose: "Bonus 3:2", faceValue: 10,
+			actions: []CorporateAction{{Kind: ActionBonus, New: 3, Old: 2}}},
+		{purpose: "Rights 1:5 @ Premium Rs 95/-", faceValue: 5,
+			actions: []CorporateAction{{Kind: ActionRights, New: 1, Old: 5, Amount: 100}}},
+		{purpose: "Rights 3:10 @ Rs 120/- Per Share", faceValue: 10,
+			actions: []CorporateAction{{Kind: ActionRights, New: 3, Old: 10, Amount: 120}}},
+		{purpose: "Interim Dividend - Rs 12 Per Share", faceValue: 5,
+			actions: []CorporateAction{{Kind: ActionDividend, Amount: 12}}},
+		{purpose: "Dividend - Re 0.50 Per Share", faceValue: 1,
+			actions: []CorporateAction{{Kind: ActionDividend, Amount: 0.5}}},
+		{purpose: "Dividend - Re.1 Per Share", faceValue: 1,
+			actions: []CorporateAction{{Kind: ActionDividend, Amount: 1}}},
+		{purpose: "Final Dividend - Rs 15 Per Share / Special Dividend - Rs 5 Per Share", faceValue: 5,
+			actions: []CorporateAction{{Kind: ActionDividend, Amount: 20}}},
+		{purpose: "Annual General Meeting/Dividend - Rs 2.50 Per Share", faceValue: 10,
+			actions: []CorporateAction{{Kind: ActionDividend, Amount: 2.5}}},
+		{purpose: "Bonus 1:2 / Dividend - Rs 3 Per Share", faceValue: 10,
+			actions: []CorporateAction{{Kind: ActionBonus, New: 1, Old: 2}, {Kind: ActionDividend, Amount: 3}}},
+		{purpose: "Annual General Meeting", faceValue: 10},
+		{purpose: "Interest Payment", faceValue: 1000},
+	}
+
+	for _, test := range tests {
+		var actions = ParseCorporateActionPurpose(test.purpose, test.faceValue)
+		if fmt.Sprintf("%+v", actions) != fmt.Sprintf("%+v", test.actions) {
+			t.Errorf("ParseCorporateActionPurpose(%q) = %+v; want %+v", test.purpose, actions, test.actions)
+		}
+	}
+}
+
+func TestReadNseCorporateActions(t *testing.T) {
+	const data = "\xef\xbb\xbfSYMBOL ,COMPANY NAME ,SERIES ,PURPOSE ,FACE VALUE ,EX-DATE ,RECORD DATE \n" +
+		"INFY,Infosys Limited,EQ,Bonus 1:1,5,04-Sep-2018,05-Sep-2018\n" +
+		"TCS,Tata Consultancy Services Limited,EQ,Interim Dividend - Rs 8 Per Share,1,15-Jul-2021,16-Jul-2021\n" +
+		"ABC,Abc Limited,EQ,Annual General Meeting,10,-,-\n" +
+		"XYZ,Xyz Limited,EQ,Annual General Meeting,10,20-Aug-2021,-\n"
+
+	var actions, err = ReadNseCorporateActions(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want = []CorporateAction{
+		{Exchange: "nse", Ticker: "INFY", ExDate: time.Date(2018, 9, 4, 0, 0, 0, 0, time.UTC), Kind: ActionBonus,
+			Old: 1, New: 1, Purpose: "Bonus 1:1"},
+		{Exchange: "nse", Ticker: "TCS", ExDate: time.Date(2021, 7, 15, 0, 0, 0, 0, time.UTC), Kind: ActionDividend,
+			Amount: 8, Purpose: "Interim Dividend - Rs 8 Per Share"},
+	}
+	if fmt.Sprintf("%+v", actions) != fmt.Sprintf("%+v", want) {
+		t.Errorf("got %+v; want %+v", actions, want)
+	}
+}
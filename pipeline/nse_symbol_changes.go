@@ -0,0 +1,78 @@
+package pipeline
+
+import (
+	scsv "encoding/csv"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NseSymbolChangesUrl is the location of NSE's list of symbol changes
+const NseSymbolChangesUrl = "https://www1.nseindia.com/content/equities/symbolchange.csv"
+
+// SymbolChange records a ticker on an exchange being renamed, effective from the given date
+type SymbolChange struct {
+	Exchange  string
+	OldSymbol string
+	NewSymbol string
+	Date      time.Time
+}
+
+// FetchNseSymbolChanges downloads and reads NSE's list of symbol changes
+func FetchNseSymbolChanges() (_ []SymbolChange, err error) {
+	var request, _ = http.NewRequest(http.MethodGet, NseSymbolChangesUrl, nil)
+	request.Header.Set("Referer", "https://www1.nseindia.com/products/content/equities/equities/archieve_eq.htm")
+
+	var response *http.Response
+	if response, err = NseSession.Do(request); err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch %q", NseSymbolChangesUrl)
+	} else if status := response.StatusCode; status != 200 {
+		_ = response.Body.Close()
+		return nil, errors.Errorf("server returned %d", status)
+	}
+	defer response.Body.Close()
+
+	return ReadNseSymbolChanges(response.Body)
+}
+
+// ReadNseSymbolChanges reads NSE's list of symbol changes from the given csv source.
+// Each row in the file is of the form: company name, old symbol, new symbol, date of change
+// with an optional header row (SM_NAME_OF_COMPANY, SM_KEY_SYMBOL, SM_NEW_SYMBOL, SM_APPLICABLE_FROM).
+func ReadNseSymbolChanges(r io.Reader) (_ []SymbolChange, err error) {
+	var changes []SymbolChange
+
+	var reader = scsv.NewReader(r)
+	reader.FieldsPerRecord = -1 // rows might contain trailing blank columns
+	reader.TrimLeadingSpace = true
+
+	for line := 1; ; line++ {
+		var record []string
+		if record, err = reader.Read(); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "failed to read symbol changes")
+		}
+
+		if len(record) < 4 {
+			return nil, errors.Errorf("unexpected number of columns in line %d", line)
+		} else if strings.HasPrefix(uc(record[0]), "SM_") { // skip header row
+			continue
+		}
+
+		var date csvDate
+		if err = date.UnmarshalCSV([]byte(strings.TrimSpace(record[3]))); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse date in line %d", line)
+		}
+
+		changes = append(changes, SymbolChange{
+			Exchange:  "nse",
+			OldSymbol: strings.TrimSpace(record[1]),
+			NewSymbol: strings.TrimSpace(record[2]),
+			Date:      date.Time,
+		})
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,41 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadNseSymbolChanges(t *testing.T) {
+	const data = `SM_NAME_OF_COMPANY,SM_KEY_SYMBOL,SM_NEW_SYMBOL,SM_APPLICABLE_FROM
+Tata Consultancy Services Limited, OLDTCS , TCS ,05-MAR-2021,
+"Zee Entertainment Enterprises Limited, Mumbai",ZEETELE,ZEEL,1-Dec-2006
+`
+	var changes, err = ReadNseSymbolChanges(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want = []SymbolChange{
+		{Exchange: "nse", OldSymbol: "OLDTCS", NewSymbol: "TCS", Date: time.Date(2021, 03, 05, 0, 0, 0, 0, time.UTC)},
+		{Exchange: "nse", OldSymbol: "ZEETELE", NewSymbol: "ZEEL", Date: time.Date(2006, 12, 01, 0, 0, 0, 0, time.UTC)},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %+v; want %+v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("got %+v; want %+v", changes[i], want[i])
+		}
+	}
+
+	var invalid = map[string]string{
+		"Infosys Limited,INFOSYSTCH,INFY\n":            "unexpected number of columns in line 1",
+		"Infosys Limited,INFOSYSTCH,INFY,2011-06-24\n": "failed to parse date in line 1",
+	}
+	for data, expected := range invalid {
+		if _, err = ReadNseSymbolChanges(strings.NewReader(data)); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error containing %q for %q; got %v", expected, data, err)
+		}
+	}
+}
@@ -4,16 +4,16 @@ package pipeline
 
 import (
 	"fmt"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
-	"net/http"
-	"runtime"
+	"io"
 	"sync"
 	"time"
 )
 
-// Client is the default http client used by the package
-// It's global (and exported) so that we can override this value in tests
-var Client = http.DefaultClient
+// Client is the http client used by the package, created with the default options (see NewClient)
+// It's global (and exported) so that it can be configured by the application, and overridden in tests
+var Client, _ = NewClient(DefaultClientOptions())
 
 // Equity represents the historical stock / equity related information
 // for a given symbol / ticker on a given exchange at a given date.
@@ -26,47 +26,157 @@ type Equity interface {
 	OHLC() (open, high, low, close float64)
 	Last() float64
 	PrevClose() float64
+	Volume() int64
 }
 
 // Resource represents a network resource that can be fetched and read from.
 type Resource interface {
 	fmt.Stringer
+	Exchange() string // exchange publishing the resource
+	Date() time.Time  // date the resource is published for
 	Fetch() (Parseable, error)
 }
 
-// Parseable represents an in-memory buffer of data that can be parsed into an Equity object
+// logger returns a logger that adds the fields identifying the resource (exchange, date and url) to every log line
+func logger(r Resource) zerolog.Logger {
+	return log.With().Str("exchange", r.Exchange()).Str("date", r.Date().Format("2006-01-02")).
+		Str("resource", r.String()).Logger()
+}
+
+// Parseable represents downloaded data that can be parsed into a stream of Equity objects.
+// Parse calls fn for each record and bad for each row that couldn't be parsed (skipping the row), stopping at the
+// first error returned by fn or bad, or encountered while reading (which makes reading the rest impossible).
+// Close releases any resources (like temporary files) held by the Parseable.
 type Parseable interface {
-	Parse() ([]Equity, error)
+	Parse(fn func(Equity) error, bad func(*RowError) error) error
+	io.Closer
+}
+
+// Options configures the concurrency of the pipeline
+type Options struct {
+	Downloaders int // number of concurrent downloaders
+	Parsers     int // number of concurrent parsers
+	BufferSize  int // capacity of the queues between stages of the pipeline
+
+	// ExchangeLimits caps the number of concurrent downloads from an exchange
+	// exchanges not in the map are limited to DefaultExchangeLimit concurrent downloads
+	ExchangeLimits map[string]int
+
+	// OnRowError (if set) is called for each row that couldn't be parsed (and is skipped).
+	// It's called concurrently from the parsers, and must be safe for concurrent use.
+	OnRowError func(*RowError)
+
+	// OnResource (if set) is called for each resource processed by the pipeline, once it's parsed (or fails to
+	// download or parse). It's called concurrently from the workers, and must be safe for concurrent use.
+	OnResource func(*ResourceResult)
+}
+
+// ResourceResult is the outcome of processing a resource in the pipeline (see Options.OnResource)
+type ResourceResult struct {
+	Resource Resource
+	Records  int   // records published (possibly not yet consumed from the pipeline)
+	Rejected int   // rows that couldn't be parsed
+	Err      error // error downloading or parsing the resource; records parsed before the error are published (see ResourceSink)
+}
+
+// DefaultExchangeLimit is the number of concurrent downloads allowed from an exchange (unless configured otherwise)
+const DefaultExchangeLimit = 2
+
+// DefaultOptions returns the default options for the pipeline.
+// The defaults are independent of number of cores, to not overwhelm the exchanges when running on large servers.
+func DefaultOptions() Options {
+	return Options{Downloaders: 4, Parsers: 2, BufferSize: 4, ExchangeLimits: make(map[string]int)}
 }
 
 // EquityPipeline creates a new background worker pipeline to process equity data
-func EquityPipeline() (chan<- Resource, <-chan []Equity) {
-	var input = make(chan Resource)
+func EquityPipeline(opts Options) (chan<- Resource, <-chan []Equity) {
+	var input, streams = equityPipeline(opts)
+	var out = make(chan []Equity)
+
+	go func() {
+		for s := range streams {
+			for records := range s.batches {
+				out <- records
+			}
+		}
+		close(out)
+	}()
+
+	return input, out
+}
+
+// equityPipeline creates the pipeline, publishing the records of each resource as a stream of batches
+func equityPipeline(opts Options) (chan<- Resource, <-chan *stream) {
+	var input = make(chan Resource, opts.BufferSize)
+	var limit = &limiter{limits: opts.ExchangeLimits, slots: make(map[string]chan struct{})}
 
-	var downloaders []<-chan Parseable
-	for i := 0; i < runtime.NumCPU()*2; i++ {
-		downloaders = append(downloaders, downloader(input))
+	var onResource = opts.OnResource
+	if onResource == nil {
+		onResource = func(*ResourceResult) {}
 	}
 
-	var dl = mergeDownloaders(downloaders...)
-	var parsers []<-chan []Equity
-	for i := 0; i < runtime.NumCPU(); i++ {
-		parsers = append(parsers, parser(dl))
+	var downloaders []<-chan *download
+	for i := 0; i < max(opts.Downloaders, 1); i++ {
+		downloaders = append(downloaders, downloader(input, limit, onResource))
 	}
 
-	return input, mergeParsers(parsers...)
+	var dl = mergeDownloaders(opts.BufferSize, downloaders...)
+	var parsers []<-chan *stream
+	for i := 0; i < max(opts.Parsers, 1); i++ {
+		parsers = append(parsers, parser(dl, opts.OnRowError, onResource))
+	}
+
+	return input, mergeParsers(opts.BufferSize, parsers...)
+}
+
+// limiter caps the number of concurrent downloads from an exchange
+type limiter struct {
+	sync.Mutex
+	limits map[string]int           // configured limits by exchange
+	slots  map[string]chan struct{} // semaphore by exchange
+}
+
+// acquire blocks till a download slot for the exchange is available, returning a function to release the slot
+func (l *limiter) acquire(exchange string) (release func()) {
+	l.Lock()
+	var slots, ok = l.slots[exchange]
+	if !ok {
+		var n, configured = l.limits[exchange]
+		if !configured || n <= 0 {
+			n = DefaultExchangeLimit
+		}
+		slots = make(chan struct{}, n)
+		l.slots[exchange] = slots
+	}
+	l.Unlock()
+
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+// download is a downloaded resource, ready to be parsed
+type download struct {
+	resource Resource
+	data     Parseable
 }
 
-func downloader(input <-chan Resource) <-chan Parseable {
-	var out = make(chan Parseable)
+func downloader(input <-chan Resource, limit *limiter, onResource func(*ResourceResult)) <-chan *download {
+	var out = make(chan *download)
 
 	go func() {
 		for resource := range input {
-			log.Debug().Str("resource", resource.String()).Msg("downloading resource")
-			if r, err := resource.Fetch(); err != nil {
-				log.Warn().Err(err).Str("resource", resource.String()).Msg("failed to download resource")
+			var log = logger(resource)
+			log.Debug().Msg("downloading resource")
+
+			var release = limit.acquire(resource.Exchange())
+			var r, err = resource.Fetch()
+			release()
+
+			if err != nil {
+				log.Warn().Err(err).Msg("failed to download resource")
+				onResource(&ResourceResult{Resource: resource, Err: err})
 			} else {
-				out <- r
+				out <- &download{resource: resource, data: r}
 			}
 		}
 		close(out)
@@ -75,16 +185,16 @@ func downloader(input <-chan Resource) <-chan Parseable {
 	return out
 }
 
-func mergeDownloaders(c ...<-chan Parseable) <-chan Parseable {
+func mergeDownloaders(size int, c ...<-chan *download) <-chan *download {
 	var wg sync.WaitGroup
-	var merged = make(chan Parseable)
+	var merged = make(chan *download, size)
 
 	// increase counter to number of channels len(c)
 	// as we will spawn number of goroutines equal to number of channels received to merge
 	wg.Add(len(c))
 
 	// function that accept a channel to push objects to merged channel
-	var output = func(pc <-chan Parseable) {
+	var output = func(pc <-chan *download) {
 		for p := range pc {
 			merged <- p
 		}
@@ -103,16 +213,58 @@ func mergeDownloaders(c ...<-chan Parseable) <-chan Parseable {
 	return merged
 }
 
-func parser(input <-chan Parseable) <-chan []Equity {
-	var out = make(chan []Equity)
+// maximum number of records published together by the parser
+// keeps memory bounded per worker regardless of size of the parsed resource
+const batchSize = 1024
+
+// stream is the records of a resource, published in batches as the resource is parsed.
+// result is the outcome of processing the resource, and is set once batches is closed.
+type stream struct {
+	batches chan []Equity
+	result  *ResourceResult
+}
+
+// parser parses the downloaded resources, publishing a stream per resource. A stream is published before its records,
+// and the parser blocks till each batch is consumed, so a consumer receives the records of a resource together
+// (see mergeParsers) and can write the resource all-or-nothing.
+func parser(input <-chan *download, onRowError func(*RowError), onResource func(*ResourceResult)) <-chan *stream {
+	var out = make(chan *stream)
 
 	go func() {
-		for r := range input {
-			if eq, err := r.Parse(); err != nil {
-				log.Warn().Err(err).Msg("failed to parse result")
-			} else {
-				out <- eq
+		for dl := range input {
+			var log = logger(dl.resource)
+			var s = &stream{batches: make(chan []Equity), result: &ResourceResult{Resource: dl.resource}}
+			out <- s
+
+			var batch = make([]Equity, 0, batchSize)
+			var err = dl.data.Parse(func(eq Equity) error {
+				if batch = append(batch, eq); len(batch) == batchSize {
+					s.result.Records += len(batch)
+					s.batches <- batch
+					batch = make([]Equity, 0, batchSize)
+				}
+				return nil
+			}, func(e *RowError) error {
+				log.Warn().Err(e.Err).Str("report", e.Report).Int("line", e.Line).Str("row", e.Row).Msg("skipping malformed row")
+				s.result.Rejected++
+				if onRowError != nil {
+					onRowError(e)
+				}
+				return nil
+			})
+
+			_ = dl.data.Close()
+
+			if err != nil {
+				log.Warn().Err(err).Int("published", s.result.Records).Msg("failed to parse resource")
+			} else if len(batch) > 0 {
+				s.result.Records += len(batch)
+				s.batches <- batch
 			}
+
+			s.result.Err = err
+			close(s.batches)
+			onResource(s.result)
 		}
 		close(out)
 	}()
@@ -120,16 +272,19 @@ func parser(input <-chan Parseable) <-chan []Equity {
 	return out
 }
 
-func mergeParsers(c ...<-chan []Equity) <-chan []Equity {
+// mergeParsers merges the streams published by the parsers. Streams are received in the order they're published;
+// as a parser publishes its next stream only after the current one is consumed, streams ahead of a stream never
+// wait on it, and consuming them in order (draining each before the next) doesn't deadlock.
+func mergeParsers(size int, c ...<-chan *stream) <-chan *stream {
 	var wg sync.WaitGroup
-	var merged = make(chan []Equity)
+	var merged = make(chan *stream, size)
 
 	// increase counter to number of channels len(c)
 	// as we will spawn number of goroutines equal to number of channels received to merge
 	wg.Add(len(c))
 
 	// function that accept a channel to push objects to merged channel
-	var output = func(pc <-chan []Equity) {
+	var output = func(pc <-chan *stream) {
 		for p := range pc {
 			merged <- p
 		}
@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"errors"
+	"go.riyazali.net/bhav/pipeline/fake"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEquityPipeline(t *testing.T) {
+	var server = serve(t)
+
+	var dates []time.Time
+	for d := day1; len(dates) < 10; d = d.AddDate(0, 0, 1) {
+		if !Holiday(d) {
+			dates = append(dates, d)
+			server.AddBse(d, fake.BseReport(d))
+			server.AddNse(d, fake.NseReport(d))
+		}
+	}
+
+	var in, out = EquityPipeline(Options{Downloaders: 3, Parsers: 2, BufferSize: 2})
+	go func() {
+		for _, source := range Sources() {
+			for _, d := range dates {
+				in <- source.Resource(d)
+			}
+			in <- source.Resource(dates[len(dates)-1].AddDate(0, 0, 1)) // not published; must be skipped
+		}
+		close(in)
+	}()
+
+	var counts = make(map[string]int)
+	for batch := range out {
+		for _, eq := range batch {
+			counts[eq.Exchange()+"/"+eq.TradingDate().Format("2006-01-02")]++
+		}
+	}
+
+	if len(counts) != 2*len(dates) {
+		t.Errorf("expected records for %d days; got %d", 2*len(dates), len(counts))
+	}
+
+	for key, n := range counts {
+		if n != 2 {
+			t.Errorf("%s: expected 2 records; got %d", key, n)
+		}
+	}
+}
+
+// truncated is a resource that yields n records and then fails, like a download that's cut short
+type truncated struct{ n int }
+
+func (r *truncated) String() string            { return "truncated" }
+func (r *truncated) Exchange() string          { return "nse" }
+func (r *truncated) Date() time.Time           { return day1 }
+func (r *truncated) Fetch() (Parseable, error) { return r, nil }
+func (r *truncated) Close() error              { return nil }
+func (r *truncated) Parse(fn func(Equity) error, _ func(*RowError) error) error {
+	for i := 0; i < r.n; i++ {
+		if err := fn(&NseEquity{Symbol: "INFY", Series: "EQ"}); err != nil {
+			return err
+		}
+	}
+	return errors.New("unexpected EOF")
+}
+
+func TestPartialResource(t *testing.T) {
+	var results []*ResourceResult
+	var in, out = EquityPipeline(Options{OnResource: func(r *ResourceResult) { results = append(results, r) }})
+	go func() { in <- &truncated{n: 2*batchSize + 1}; close(in) }()
+
+	// records are published in batches as they're parsed; the batch being filled when parsing fails is discarded
+	var batches []int
+	for batch := range out {
+		batches = append(batches, len(batch))
+	}
+
+	if len(batches) != 2 || batches[0] != batchSize || batches[1] != batchSize {
+		t.Errorf("expected 2 full batches from a resource that failed to parse; got %v", batches)
+	}
+	if len(results) != 1 || results[0].Err == nil || results[0].Records != 2*batchSize {
+		t.Errorf("expected the resource to be reported as failed with %d records; got %+v", 2*batchSize, results)
+	}
+}
+
+func TestExchangeLimits(t *testing.T) {
+	var server = serve(t)
+
+	var dates []time.Time
+	for d := day1; len(dates) < 10; d = d.AddDate(0, 0, 1) {
+		if !Holiday(d) {
+			dates = append(dates, d)
+			server.AddBse(d, fake.BseReport(d))
+			server.AddNse(d, fake.NseReport(d))
+		}
+	}
+
+	// count the downloads in flight per exchange, holding each for a while so that downloads overlap
+	var mu sync.Mutex
+	var inflight, peak = make(map[string]int), make(map[string]int)
+	var transport = Client.Transport
+	Client = &http.Client{Transport: roundTripper(func(r *http.Request) (*http.Response, error) {
+		if !strings.HasSuffix(r.URL.Path, ".zip") { // not a download (like nse's landing page)
+			return transport.RoundTrip(r)
+		}
+
+		var exchange = "nse"
+		if strings.Contains(r.URL.Host, "bse") {
+			exchange = "bse"
+		}
+
+		mu.Lock()
+		if inflight[exchange]++; inflight[exchange] > peak[exchange] {
+			peak[exchange] = inflight[exchange]
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+		defer func() { mu.Lock(); inflight[exchange]--; mu.Unlock() }()
+		return transport.RoundTrip(r)
+	})}
+
+	// bse is capped at 3; nse isn't configured, and gets the default
+	var in, out = EquityPipeline(Options{Downloaders: 8, Parsers: 2, BufferSize: 8, ExchangeLimits: map[string]int{"bse": 3}})
+	go func() {
+		for _, d := range dates {
+			for _, source := range Sources() {
+				in <- source.Resource(d)
+			}
+		}
+		close(in)
+	}()
+
+	var records int
+	for batch := range out {
+		records += len(batch)
+	}
+
+	if records != 4*len(dates) {
+		t.Errorf("expected %d records; got %d", 4*len(dates), records)
+	}
+	if peak["bse"] != 3 || peak["nse"] != DefaultExchangeLimit {
+		t.Errorf("expected at most (and up to) 3 downloads from bse and %d from nse in flight; got %v", DefaultExchangeLimit, peak)
+	}
+}
+
+// roundTripper is an adapter to use ordinary functions as http.RoundTripper
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
@@ -0,0 +1,137 @@
+package pipeline
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"sync"
+)
+
+// DefaultUserAgent is the user agent sent by sessions (unless configured otherwise).
+// Some exchanges reject requests that don't look like they are coming from a browser.
+const DefaultUserAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.114 Safari/537.36"
+
+// Session is a browser-like session with an exchange's website. Before the first request, it visits
+// a landing page to obtain the cookies the exchange expects, and it sends those cookies (along with
+// configured headers) with every request. If the exchange rejects a request (with 401 or 403),
+// the session is refreshed and the request is retried once.
+//
+// A Session is safe for concurrent use, and is shared by all the workers of the pipeline.
+type Session struct {
+	Landing string // page visited to obtain the cookies
+
+	sync.Mutex
+	headers    http.Header
+	jar        *cookiejar.Jar
+	generation int // incremented every time the session is (re-)primed; zero if not primed yet
+}
+
+// NewSession creates a new session that primes its cookies by visiting the landing page
+func NewSession(landing string, headers map[string]string) *Session {
+	var session = &Session{Landing: landing, headers: make(http.Header)}
+	session.headers.Set("User-Agent", DefaultUserAgent)
+	for key, value := range headers {
+		session.headers.Set(key, value)
+	}
+	return session
+}
+
+// SetHeader sets a header sent with every request made in the session
+func (s *Session) SetHeader(key, value string) {
+	s.Lock()
+	defer s.Unlock()
+	s.headers.Set(key, value)
+}
+
+// Do sends the request within the session. The request must not have a body.
+func (s *Session) Do(request *http.Request) (_ *http.Response, err error) {
+	var generation int
+	if generation, err = s.prime(0); err != nil {
+		return nil, err
+	}
+
+	var response *http.Response
+	if response, err = s.do(request); err != nil {
+		return nil, err
+	}
+
+	if status := response.StatusCode; status == http.StatusUnauthorized || status == http.StatusForbidden {
+		log.Debug().Str("landing", s.Landing).Int("status", status).Msg("request rejected; refreshing session")
+		_, _ = io.Copy(io.Discard, response.Body)
+		_ = response.Body.Close()
+
+		if _, err = s.prime(generation); err != nil {
+			return nil, err
+		}
+		return s.do(request)
+	}
+
+	return response, nil
+}
+
+// prime visits the landing page to (re-)initialise the session, unless the session has already been
+// primed after the given generation (by another worker). It returns the current generation of the session.
+func (s *Session) prime(after int) (_ int, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.generation > after {
+		return s.generation, nil
+	}
+
+	log.Debug().Str("landing", s.Landing).Msg("priming session")
+	if s.jar, err = cookiejar.New(nil); err != nil {
+		return 0, err
+	}
+
+	var request *http.Request
+	if request, err = http.NewRequest(http.MethodGet, s.Landing, nil); err != nil {
+		return 0, errors.Wrapf(err, "invalid landing page %q", s.Landing)
+	}
+	s.prepare(request)
+
+	var response *http.Response
+	if response, err = s.client().Do(request); err != nil {
+		return 0, errors.Wrapf(err, "failed to visit landing page %q", s.Landing)
+	}
+	_, _ = io.Copy(io.Discard, response.Body)
+	_ = response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return 0, errors.Errorf("landing page %q returned %d", s.Landing, response.StatusCode)
+	}
+
+	s.generation++
+	return s.generation, nil
+}
+
+// do sends a copy of the request with the session's headers and cookies
+func (s *Session) do(request *http.Request) (_ *http.Response, err error) {
+	request = request.Clone(request.Context())
+
+	s.Lock()
+	s.prepare(request)
+	var client = s.client()
+	s.Unlock()
+
+	return client.Do(request)
+}
+
+// client returns a client that sends the session's cookies, and records the cookies set by every response
+// (including redirects) in the session. It uses the transport and limits of the package's Client.
+// It must be called with the lock held.
+func (s *Session) client() *http.Client {
+	return &http.Client{Jar: s.jar, Transport: Client.Transport, CheckRedirect: Client.CheckRedirect, Timeout: Client.Timeout}
+}
+
+// prepare sets the session's headers (unless already set on the request) on the request
+// It must be called with the lock held.
+func (s *Session) prepare(request *http.Request) {
+	for key, values := range s.headers {
+		if request.Header.Get(key) == "" {
+			request.Header[key] = values
+		}
+	}
+}
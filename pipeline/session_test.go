@@ -0,0 +1,72 @@
+package pipeline
+
+import (
+	"go.riyazali.net/bhav/pipeline/fake"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNseSessionRefresh(t *testing.T) {
+	var server = serve(t)
+	server.AddNse(day1, fake.NseReport(day1))
+
+	if _, err := fetchAll(t, "nse/equity", day1); err != nil {
+		t.Fatal(err)
+	}
+
+	server.ExpireSession()
+	if _, err := fetchAll(t, "nse/equity", day1); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := server.Sessions(); n != 2 {
+		t.Errorf("expected session to be refreshed once; got %d sessions", n)
+	}
+}
+
+// cookies set on redirects (of the landing page, or of a request) must be kept in the session
+func TestSessionRedirectCookies(t *testing.T) {
+	var set = func(w http.ResponseWriter, name string) {
+		http.SetCookie(w, &http.Cookie{Name: name, Value: "1", Path: "/"})
+	}
+	var mux = http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { // landing page redirects to home
+		set(w, "landing")
+		http.Redirect(w, r, "/home", http.StatusFound)
+	})
+	mux.HandleFunc("/home", func(w http.ResponseWriter, r *http.Request) { set(w, "home") })
+	mux.HandleFunc("/report", func(w http.ResponseWriter, r *http.Request) {
+		set(w, "report")
+		http.Redirect(w, r, "/download", http.StatusFound)
+	})
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range []string{"landing", "home", "report"} {
+			if _, err := r.Cookie(name); err != nil {
+				http.Error(w, "missing cookie "+name, http.StatusForbidden)
+				return
+			}
+		}
+		_, _ = io.WriteString(w, "ok")
+	})
+
+	var server = httptest.NewServer(mux)
+	defer server.Close()
+
+	var client = Client
+	Client = server.Client()
+	defer func() { Client = client }()
+
+	var session = NewSession(server.URL+"/", nil)
+	var request, _ = http.NewRequest(http.MethodGet, server.URL+"/report", nil)
+	var response, err = session.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if body, _ := io.ReadAll(response.Body); response.StatusCode != http.StatusOK {
+		t.Errorf("expected the request to carry cookies set on redirects; got %d: %s", response.StatusCode, body)
+	}
+}
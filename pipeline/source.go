@@ -0,0 +1,151 @@
+package pipeline
+
+import (
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Source describes a data source that publishes a report (bhavcopy) for each trading day.
+// Sources are registered with the package (see Register) and used to generate resources
+// for the pipeline, so that a new feed can be added by registering a new Source.
+type Source struct {
+	Name     string // unique name of the source, like bse/equity
+	Exchange string // exchange publishing the report
+	Segment  string // market segment the report belongs to, like equity
+
+	// URL is the template for the location of the report on a given date.
+	// {layout} in the template is replaced by the date formatted with the layout (see time.Format)
+	// and {layout:upper} by the upper-cased formatted date. For example: cm{02Jan2006:upper}bhav.csv.zip
+	URL string
+
+	// Member is the template (same as URL) for the name of the report in the zip archive (matched case-insensitively).
+	// It is ignored if the report is published as plain or gzip-ed csv, and if empty, the archive must contain a single file.
+	Member string
+
+	// Headers are set on the request to fetch the report
+	Headers map[string]string
+
+	// Session (if set) is used to fetch the report, for exchanges that expect browser-like sessions
+	Session *Session
+
+	// Parse parses the report published on the given date, calling fn for each record in it
+	// and bad for each row that couldn't be parsed (see Parseable)
+	Parse func(r io.Reader, date time.Time, fn func(Equity) error, bad func(*RowError) error) error
+
+	// Holiday returns true if the exchange doesn't trade on the given day
+	Holiday func(d time.Time) bool
+
+	// Start is the earliest date for which the report is available
+	Start time.Time
+}
+
+// Resource returns the resource for the report published on the given date
+func (s *Source) Resource(on time.Time) Resource { return &sourceResource{source: s, date: on} }
+
+// registry of sources by name
+var registry = struct {
+	sync.RWMutex
+	sources map[string]*Source
+}{sources: make(map[string]*Source)}
+
+// Register registers a new Source, replacing any source registered with the same name
+func Register(s *Source) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.sources[s.Name] = s
+}
+
+// Sources returns all registered sources, sorted by name
+func Sources() []*Source {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	var sources = make([]*Source, 0, len(registry.sources))
+	for _, s := range registry.sources {
+		sources = append(sources, s)
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Name < sources[j].Name })
+	return sources
+}
+
+// Lookup returns the source registered with the given name
+func Lookup(name string) (*Source, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	var s, ok = registry.sources[name]
+	return s, ok
+}
+
+// matches {layout} and {layout:upper} placeholders in templates
+var rePlaceholder = regexp.MustCompile(`\{([^}:]+)(:upper)?\}`)
+
+// expand expands the placeholders in the template using the given date
+func expand(template string, date time.Time) string {
+	return rePlaceholder.ReplaceAllStringFunc(template, func(m string) string {
+		var parts = rePlaceholder.FindStringSubmatch(m)
+		if parts[2] != "" {
+			return uc(date.Format(parts[1]))
+		}
+		return date.Format(parts[1])
+	})
+}
+
+// sourceResource is the report published by a source on the given date
+type sourceResource struct {
+	source *Source
+	date   time.Time
+}
+
+func (r *sourceResource) String() string   { return expand(r.source.URL, r.date) }
+func (r *sourceResource) Exchange() string { return r.source.Exchange }
+func (r *sourceResource) Date() time.Time  { return r.date }
+
+func (r *sourceResource) Fetch() (_ Parseable, err error) {
+	var request, _ = http.NewRequest(http.MethodGet, expand(r.source.URL, r.date), nil)
+	for key, value := range r.source.Headers {
+		request.Header.Set(key, value)
+	}
+
+	var client doer = Client
+	if r.source.Session != nil {
+		client = r.source.Session
+	}
+
+	var data = &sourceData{source: r.source, date: r.date}
+	if data.report, err = fetch(client, request, expand(r.source.Member, r.date)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// sourceData is a report downloaded from a source
+type sourceData struct {
+	source *Source
+	date   time.Time
+	report *report
+}
+
+func (d *sourceData) Parse(fn func(Equity) error, bad func(*RowError) error) (err error) {
+	var rc io.ReadCloser
+	if rc, err = d.report.Open(); err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	var report = d.report.String()
+	var withSource = func(e *RowError) error {
+		e.Source, e.Report, e.Date = d.source.Name, report, d.date
+		return bad(e)
+	}
+	if err = d.source.Parse(rc, d.date, fn, withSource); err != nil {
+		return errors.Wrapf(err, "failed to parse %s", d.report.url)
+	}
+	return nil
+}
+
+func (d *sourceData) Close() error { return d.report.Close() }
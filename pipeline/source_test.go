@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"github.com/pkg/errors"
+	"go.riyazali.net/bhav/pipeline/fake"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var day1 = time.Date(2021, 03, 05, 0, 0, 0, 0, time.UTC)
+
+// serve starts a fake exchange and redirects requests made by the package to it till the test ends
+func serve(t *testing.T) *fake.Server {
+	var server = fake.NewServer()
+	var client = Client
+	Client = server.Client()
+	t.Cleanup(func() { Client = client; server.Close() })
+	return server
+}
+
+// fetchAll fetches the resource published by the named source on the given date and parses all records
+// It fails at the first row that couldn't be parsed.
+func fetchAll(t *testing.T, name string, date time.Time) ([]Equity, error) {
+	t.Helper()
+	var source, ok = Lookup(name)
+	if !ok {
+		t.Fatalf("source %s not registered", name)
+	}
+
+	var data, err = source.Resource(date).Fetch()
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+
+	var records []Equity
+	err = data.Parse(func(eq Equity) error { records = append(records, eq); return nil }, func(e *RowError) error { return e })
+	return records, err
+}
+
+func TestBseEquity(t *testing.T) {
+	var server = serve(t)
+	server.AddBse(day1, fake.BseReport(day1))
+
+	var records, err = fetchAll(t, "bse/equity", day1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records; got %d", len(records))
+	}
+
+	var infy = records[0]
+	if infy.Exchange() != "bse" || infy.Ticker() != "INFY" || infy.ISIN() != "INE009A01021" || infy.Type() != "Q" {
+		t.Errorf("unexpected record: %s %s %s %s", infy.Exchange(), infy.Ticker(), infy.ISIN(), infy.Type())
+	}
+
+	if !infy.TradingDate().Equal(day1) {
+		t.Errorf("expected trading date %s; got %s", day1, infy.TradingDate())
+	}
+
+	if o, h, l, c := infy.OHLC(); o != 1305 || h != 1315 || l != 1295 || c != 1310 {
+		t.Errorf("unexpected ohlc: %v %v %v %v", o, h, l, c)
+	}
+
+	if infy.Volume() != 1000 || infy.PrevClose() != 1309 {
+		t.Errorf("unexpected volume / previous close: %d %v", infy.Volume(), infy.PrevClose())
+	}
+}
+
+func TestNseEquity(t *testing.T) {
+	var server = serve(t)
+	server.AddNse(day1, fake.NseReport(day1))
+
+	var records, err = fetchAll(t, "nse/equity", day1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records; got %d", len(records))
+	}
+
+	var tcs = records[1]
+	if tcs.Exchange() != "nse" || tcs.Ticker() != "TCS" || tcs.ISIN() != "INE467B01029" || tcs.Type() != "EQ" {
+		t.Errorf("unexpected record: %s %s %s %s", tcs.Exchange(), tcs.Ticker(), tcs.ISIN(), tcs.Type())
+	}
+
+	if !tcs.TradingDate().Equal(day1) {
+		t.Errorf("expected trading date %s; got %s", day1, tcs.TradingDate())
+	}
+
+	if o, h, l, c := tcs.OHLC(); o != 3005 || h != 3015 || l != 2995 || c != 3010 {
+		t.Errorf("unexpected ohlc: %v %v %v %v", o, h, l, c)
+	}
+
+	if tcs.Volume() != 4000 || tcs.Last() != 3010 {
+		t.Errorf("unexpected volume / last: %d %v", tcs.Volume(), tcs.Last())
+	}
+}
+
+func TestMissingReport(t *testing.T) {
+	serve(t)
+
+	var _, err = fetchAll(t, "bse/equity", day1)
+
+	var fe *FetchError
+	if !errors.As(err, &fe) || fe.Status != http.StatusNotFound {
+		t.Fatalf("expected fetch error with status 404; got %v", err)
+	}
+}
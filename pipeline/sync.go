@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"time"
+)
+
+var day = 24 * time.Hour
+
+// Job is a range of dates (inclusive) to sync from a source; days that are holidays per the source's calendar are skipped.
+// If Dates is set, those dates are synced instead (including holidays, as they're asked for explicitly).
+type Job struct {
+	Source   *Source
+	From, To time.Time
+	Dates    []time.Time
+}
+
+// Days returns the days the job syncs, in order
+func (j *Job) Days() []time.Time {
+	if j.Dates != nil {
+		return j.Dates
+	}
+
+	var days []time.Time
+	for d := j.From; !d.After(j.To); d = d.Add(day) {
+		if !j.Source.Holiday(d) {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// Sink receives the records published by a sync, in batches. Write is called from a single goroutine,
+// and the batches of a resource are written together (not interleaved with batches of another resource).
+type Sink interface {
+	Write([]Equity) error
+}
+
+// ResourceSink is a Sink that's told when all records of a resource are written, along with the outcome of the
+// resource. It can use it to write a resource all-or-nothing, like with a savepoint per resource that's rolled back
+// if the resource failed to parse midway (or the sync stopped before the resource was done).
+// End is only called for resources with records written to the sink, from the goroutine calling Write.
+type ResourceSink interface {
+	Sink
+	End(*ResourceResult) error
+}
+
+// SinkFunc is an adapter to use a function as a Sink
+type SinkFunc func([]Equity) error
+
+func (fn SinkFunc) Write(records []Equity) error { return fn(records) }
+
+// SyncOptions configures a sync (see Sync)
+type SyncOptions struct {
+	Options       // configures the pipeline used by the sync
+	Jobs    []Job // what to sync
+	Sink    Sink  // where to write the records to
+}
+
+// SyncResult summarises a sync
+type SyncResult struct {
+	Resources int           // resources processed (see ResourceResult)
+	Failed    int           // resources that couldn't be downloaded or parsed
+	Records   int           // records written to the sink
+	Rejected  int           // rows that couldn't be parsed (see RowError)
+	Duration  time.Duration // time taken by the sync
+}
+
+// Sync runs the jobs through a new pipeline, writing the records to the sink. It returns when all the jobs are done,
+// the sink fails (returning its error) or the context is cancelled (returning the context's error); on failure,
+// resources already being processed are processed, but their records are discarded. The hooks in opts.Options
+// (OnResource, OnRowError) can be used to follow the progress of the sync.
+func Sync(ctx context.Context, opts SyncOptions) (_ *SyncResult, err error) {
+	if opts.Sink == nil {
+		return nil, errors.New("sync requires a sink")
+	}
+
+	var started = time.Now()
+	var result = &SyncResult{}
+	var mu sync.Mutex // guards result, updated concurrently by the workers
+
+	var onResource = opts.OnResource
+	opts.OnResource = func(r *ResourceResult) {
+		mu.Lock()
+		if result.Resources++; r.Err != nil {
+			result.Failed++
+		}
+		result.Rejected += r.Rejected
+		mu.Unlock()
+
+		if onResource != nil {
+			onResource(r)
+		}
+	}
+
+	var cancellable, cancel = context.WithCancel(ctx)
+	defer cancel()
+
+	var in, streams = equityPipeline(opts.Options)
+
+	{ // start an enqueue task per job (so that exchanges are synced concurrently) and close input once they're done
+		var wg sync.WaitGroup
+		wg.Add(len(opts.Jobs))
+		for i := range opts.Jobs {
+			go func(job *Job) { defer wg.Done(); enqueue(cancellable, job, in) }(&opts.Jobs[i])
+		}
+		go func() { wg.Wait(); close(in) }()
+	}
+
+	var rs, _ = opts.Sink.(ResourceSink)
+	for s := range streams {
+		var written, dropped bool // whether records of the resource are written to, or dropped before, the sink
+		for records := range s.batches {
+			if err != nil || cancellable.Err() != nil {
+				dropped = true
+				continue // drain the pipeline
+			}
+
+			written = true
+			if err = opts.Sink.Write(records); err != nil {
+				dropped = true
+				cancel()
+				continue
+			}
+			result.Records += len(records)
+		}
+
+		if rs != nil && written {
+			var r = *s.result
+			if r.Err == nil && dropped { // the sync stopped midway through the resource
+				if r.Err = err; r.Err == nil {
+					r.Err = cancellable.Err()
+				}
+			}
+
+			if e := rs.End(&r); e != nil && err == nil {
+				err = e
+				cancel()
+			}
+		}
+	}
+
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	result.Duration = time.Since(started)
+	return result, err
+}
+
+// enqueue pushes the resources published by the job's source on the job's days into the pipeline's input,
+// till all are pushed or the context is cancelled
+func enqueue(ctx context.Context, job *Job, in chan<- Resource) {
+	var push = func(d time.Time) bool {
+		var resource = job.Source.Resource(d)
+		var log = logger(resource)
+		log.Debug().Str("source", job.Source.Name).Msg("enqueuing resource")
+		select {
+		case in <- resource:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	if job.Dates != nil {
+		for _, d := range job.Dates {
+			if !push(d) {
+				return
+			}
+		}
+		return
+	}
+
+	for d := job.From; !d.After(job.To); d = d.Add(day) {
+		if job.Source.Holiday(d) {
+			log.Info().Str("source", job.Source.Name).Str("exchange", job.Source.Exchange).
+				Str("date", d.Format("2006-01-02")).Msg("skipping holiday")
+			continue
+		}
+
+		if !push(d) {
+			return
+		}
+	}
+}
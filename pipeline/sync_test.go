@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"go.riyazali.net/bhav/pipeline/fake"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSync(t *testing.T) {
+	var server = serve(t)
+
+	var from, to = time.Date(2021, 03, 01, 0, 0, 0, 0, time.UTC), time.Date(2021, 03, 14, 0, 0, 0, 0, time.UTC)
+	var jobs []Job
+	for _, source := range Sources() {
+		jobs = append(jobs, Job{Source: source, From: from, To: to})
+	}
+
+	var days = jobs[0].Days()
+	if len(days) != 10 {
+		t.Fatalf("expected 10 trading days; got %d", len(days))
+	}
+	for _, d := range days[:len(days)-1] { // last day isn't published; must fail
+		server.AddBse(d, fake.BseReport(d))
+		server.AddNse(d, fake.NseReport(d))
+	}
+
+	var mu sync.Mutex
+	var resources, failed int
+	var opts = SyncOptions{Options: DefaultOptions(), Jobs: jobs}
+	opts.OnResource = func(r *ResourceResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		if resources++; r.Err != nil {
+			failed++
+		} else if r.Records != 2 {
+			t.Errorf("%s: expected 2 records; got %d", r.Resource, r.Records)
+		}
+	}
+
+	var sink = &resourceSink{t: t, records: make(map[string]int)}
+	opts.Sink = sink
+
+	var result, err = Sync(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records = sink.records
+
+	if sink.ended != 18 {
+		t.Errorf("expected sink to be told of the end of 18 resources; got %d", sink.ended)
+	}
+
+	if resources != 20 || failed != 2 {
+		t.Errorf("expected hook to be called for 20 resources with 2 failures; got %d and %d", resources, failed)
+	}
+	if result.Resources != 20 || result.Failed != 2 || result.Records != 36 || len(records) != 18 {
+		t.Errorf("unexpected result %+v (records for %d days)", result, len(records))
+	}
+}
+
+// resourceSink is a ResourceSink that checks the batches of a resource are written together, followed by End
+type resourceSink struct {
+	t       *testing.T
+	current string         // resource being written (exchange/date); empty between resources
+	records map[string]int // records written, by resource
+	ended   int            // resources ended
+}
+
+func (s *resourceSink) Write(batch []Equity) error {
+	for _, eq := range batch {
+		var key = eq.Exchange() + "/" + eq.TradingDate().Format("2006-01-02")
+		if s.current == "" {
+			s.current = key
+		} else if key != s.current {
+			s.t.Errorf("record of %s written before end of %s", key, s.current)
+		}
+		s.records[key]++
+	}
+	return nil
+}
+
+func (s *resourceSink) End(r *ResourceResult) error {
+	if key := r.Resource.Exchange() + "/" + r.Resource.Date().Format("2006-01-02"); key != s.current {
+		s.t.Errorf("end of %s while writing %s", key, s.current)
+	} else if r.Err != nil {
+		s.t.Errorf("%s: unexpected error %v", key, r.Err)
+	}
+	s.current, s.ended = "", s.ended+1
+	return nil
+}
+
+func TestSyncStops(t *testing.T) {
+	var server = serve(t)
+	var source, _ = Lookup("bse/equity")
+
+	var dates []time.Time
+	for d := day1; len(dates) < 10; d = d.AddDate(0, 0, 1) {
+		if !Holiday(d) {
+			dates = append(dates, d)
+			server.AddBse(d, fake.BseReport(d))
+		}
+	}
+
+	var failure = errors.New("disk full")
+	var opts = SyncOptions{Options: DefaultOptions(), Jobs: []Job{{Source: source, Dates: dates}}}
+	opts.Sink = SinkFunc(func([]Equity) error { return failure })
+
+	if _, err := Sync(context.Background(), opts); err != failure {
+		t.Errorf("expected sync to fail with error from sink; got %v", err)
+	}
+
+	// a resource sink is told the resource it failed to write failed, so it can roll it back
+	var sink = &failingSink{err: failure}
+	opts.Sink = sink
+	if _, err := Sync(context.Background(), opts); err != failure {
+		t.Errorf("expected sync to fail with error from sink; got %v", err)
+	} else if len(sink.ended) != 1 || sink.ended[0] != failure {
+		t.Errorf("expected sink to be told of the failed resource only; got %v", sink.ended)
+	}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	opts.Sink = SinkFunc(func([]Equity) error { return nil })
+	if _, err := Sync(ctx, opts); err != context.Canceled {
+		t.Errorf("expected sync to be cancelled; got %v", err)
+	}
+}
+
+// failingSink is a ResourceSink that fails to write, recording the outcome of each resource it's told of
+type failingSink struct {
+	err   error
+	ended []error
+}
+
+func (s *failingSink) Write([]Equity) error        { return s.err }
+func (s *failingSink) End(r *ResourceResult) error { s.ended = append(s.ended, r.Err); return nil }
@@ -1,17 +1,19 @@
 package pipeline
 
 import (
+	"io"
+	"os"
 	"strings"
 	"time"
 )
 
 var uc = strings.ToUpper
 
-// helper to deal with data format in reports
+// helper to deal with data format in reports (like 05-MAR-2021)
 type csvDate struct{ time.Time }
 
 func (b *csvDate) UnmarshalCSV(data []byte) error {
-	if tt, err := time.Parse("2-Jan-2006",string(data)); err != nil {
+	if tt, err := time.Parse("2-Jan-2006", strings.TrimSpace(string(data))); err != nil {
 		return err
 	} else {
 		*b = csvDate{Time: tt}
@@ -19,9 +21,37 @@ func (b *csvDate) UnmarshalCSV(data []byte) error {
 	}
 }
 
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 func defaultsTo(v string, def string) string {
 	if strings.TrimSpace(v) == "" {
 		return def
 	}
 	return v
-}
\ No newline at end of file
+}
+
+// spool copies r into a temporary file, so that it can be read randomly (as zip archives need to be)
+// without holding everything in memory. The returned file must be released using release()
+func spool(r io.Reader) (_ *os.File, size int64, err error) {
+	var file *os.File
+	if file, err = os.CreateTemp("", "bhav-*"); err != nil {
+		return nil, 0, err
+	}
+
+	if size, err = io.Copy(file, r); err != nil {
+		_ = release(file)
+		return nil, 0, err
+	}
+	return file, size, nil
+}
+
+// release closes and removes a temporary file created using spool()
+func release(file *os.File) error {
+	_ = file.Close()
+	return os.Remove(file.Name())
+}
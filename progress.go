@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"go.riyazali.net/bhav/pipeline"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how the progress of a sync is reported: auto (bar on a terminal, log otherwise), bar, log or none
+var reportProgress = progressMode("auto")
+
+// progressMode implements pflag.Value for --progress
+type progressMode string
+
+func (m *progressMode) String() string { return string(*m) }
+func (m *progressMode) Type() string   { return "mode" }
+func (m *progressMode) Set(s string) error {
+	switch s {
+	case "auto", "bar", "log", "none":
+		*m = progressMode(s)
+		return nil
+	}
+	return fmt.Errorf("must be one of auto, bar, log, none")
+}
+
+// interval between progress reports; the bar is redrawn more often as it doesn't add to the logs
+const progressLogInterval = 15 * time.Second
+const progressBarInterval = 250 * time.Millisecond
+
+// statusWriter writes to the underlying writer (like stderr) while keeping a status line (like a progress bar)
+// at the bottom: the status line is cleared before every write, and drawn again after it.
+type statusWriter struct {
+	sync.Mutex
+	out    io.Writer
+	status string
+}
+
+// stderr is where logs (and the progress bar) are written to
+var stderr = &statusWriter{out: os.Stderr}
+
+func (w *statusWriter) Write(p []byte) (n int, err error) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.status == "" {
+		return w.out.Write(p)
+	}
+
+	_, _ = io.WriteString(w.out, "\r\033[K")
+	n, err = w.out.Write(p)
+	_, _ = io.WriteString(w.out, w.status)
+	return n, err
+}
+
+// setStatus replaces the status line; an empty status clears it
+func (w *statusWriter) setStatus(status string) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.status != "" || status != "" {
+		_, _ = io.WriteString(w.out, "\r\033[K"+status)
+	}
+	w.status = status
+}
+
+// isTerminal returns true if the file is a terminal
+func isTerminal(f *os.File) bool {
+	var stat, err = f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// exchangeProgress is the progress of a sync for an exchange
+type exchangeProgress struct {
+	total, done, failed int // days to sync, days done (including failed) and days failed
+	rows                int // rows inserted (or updated)
+}
+
+// progress tracks the progress of a sync using the events from the pipeline (see syncEquities),
+// and reports it as a live bar on a terminal or as periodic log events.
+type progress struct {
+	sync.Mutex
+	started   time.Time
+	exchanges map[string]*exchangeProgress
+}
+
+func newProgress(jobs []pipeline.Job) *progress {
+	var p = &progress{started: time.Now(), exchanges: make(map[string]*exchangeProgress)}
+	for i := range jobs {
+		var exchange = jobs[i].Source.Exchange
+		if p.exchanges[exchange] == nil {
+			p.exchanges[exchange] = &exchangeProgress{}
+		}
+		p.exchanges[exchange].total += len(jobs[i].Days())
+	}
+	return p
+}
+
+// resource records a resource (a day) processed by the pipeline; it implements pipeline.Options.OnResource
+func (p *progress) resource(r *pipeline.ResourceResult) {
+	p.Lock()
+	defer p.Unlock()
+
+	if e := p.exchanges[r.Resource.Exchange()]; e != nil {
+		if e.done++; r.Err != nil {
+			e.failed++
+		}
+	}
+}
+
+// inserted records rows inserted for the exchange
+func (p *progress) inserted(exchange string, n int) {
+	p.Lock()
+	defer p.Unlock()
+
+	if e := p.exchanges[exchange]; e != nil {
+		e.rows += n
+	}
+}
+
+// sortedExchanges returns the exchanges being synced, in order
+func (p *progress) sortedExchanges() []string {
+	var exchanges = make([]string, 0, len(p.exchanges))
+	for exchange := range p.exchanges {
+		exchanges = append(exchanges, exchange)
+	}
+	sort.Strings(exchanges)
+	return exchanges
+}
+
+// rate returns the throughput (days per second) and the estimated time to complete the remaining days
+// It returns zero eta till the first day is done.
+func (p *progress) rate(done, total int) (rate float64, eta time.Duration) {
+	var elapsed = time.Since(p.started).Seconds()
+	if done == 0 || elapsed == 0 {
+		return 0, 0
+	}
+
+	rate = float64(done) / elapsed
+	return rate, time.Duration(float64(total-done) / rate * float64(time.Second)).Round(time.Second)
+}
+
+// bar renders the progress as a single line, like
+// [=======>            ]  37% bse 120/300 nse 150/480 | 45210 rows | 3.2 days/s | eta 4m5s
+func (p *progress) bar() string {
+	p.Lock()
+	defer p.Unlock()
+
+	const width = 20
+	var sb strings.Builder
+	var done, total, rows int
+	for _, exchange := range p.sortedExchanges() {
+		var e = p.exchanges[exchange]
+		done, total, rows = done+e.done, total+e.total, rows+e.rows
+		_, _ = fmt.Fprintf(&sb, " %s %d/%d", exchange, e.done, e.total)
+	}
+
+	var fraction = 1.0
+	if total > 0 {
+		fraction = float64(done) / float64(total)
+	}
+
+	var filled = int(fraction * width)
+	var bar = strings.Repeat("=", filled)
+	if filled < width {
+		bar += ">" + strings.Repeat(" ", width-filled-1)
+	}
+
+	var rate, eta = p.rate(done, total)
+	return fmt.Sprintf("[%s] %3.0f%%%s | %d rows | %.1f days/s | eta %s", bar, fraction*100, sb.String(), rows, rate, eta)
+}
+
+// log reports the progress for each exchange as a log event
+func (p *progress) log() {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, exchange := range p.sortedExchanges() {
+		var e = p.exchanges[exchange]
+		var rate, eta = p.rate(e.done, e.total)
+		log.Info().Str("exchange", exchange).Int("done", e.done).Int("total", e.total).Int("failed", e.failed).
+			Int("rows", e.rows).Float64("rate", rate).Dur("eta", eta).Msg("sync progress")
+	}
+}
+
+// start starts reporting the progress (as configured using --progress) in the background,
+// returning a function to stop reporting, which reports the final progress
+func (p *progress) start() (stop func()) {
+	var mode = string(reportProgress)
+	if mode == "auto" {
+		if mode = "log"; isTerminal(os.Stderr) {
+			mode = "bar"
+		}
+	}
+
+	var report func()
+	var interval time.Duration
+	switch mode {
+	case "bar":
+		report, interval = func() { stderr.setStatus(p.bar()) }, progressBarInterval
+	case "log":
+		report, interval = p.log, progressLogInterval
+	default:
+		return func() {}
+	}
+
+	var done = make(chan struct{})
+	var stopped = make(chan struct{})
+	go func() {
+		defer close(stopped)
+		var ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				report()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		if mode == "bar" {
+			var final = p.bar()
+			stderr.setStatus("")
+			_, _ = fmt.Fprintln(stderr, final)
+		} else {
+			report()
+		}
+	}
+}
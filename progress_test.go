@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"go.riyazali.net/bhav/pipeline"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	var bse, _ = pipeline.Lookup("bse/equity")
+	var nse, _ = pipeline.Lookup("nse/equity")
+
+	var from = time.Date(2021, 03, 01, 0, 0, 0, 0, time.UTC) // monday
+	var p = newProgress([]pipeline.Job{
+		{Source: bse, From: from, To: from.AddDate(0, 0, 13)}, // 10 trading days
+		{Source: nse, Dates: []time.Time{from, from.AddDate(0, 0, 1)}},
+	})
+
+	var date = from
+	var resource = func(source *pipeline.Source, err error) {
+		p.resource(&pipeline.ResourceResult{Resource: source.Resource(date), Records: 2, Err: err})
+	}
+	resource(bse, nil)
+	resource(bse, errors.New("not found"))
+	resource(nse, nil)
+	p.inserted("bse", 2)
+	p.inserted("nse", 2)
+
+	var bar = p.bar()
+	for _, want := range []string{"[=====>", " 25% ", "bse 2/10", "nse 1/2", "| 4 rows |"} {
+		if !strings.Contains(bar, want) {
+			t.Errorf("expected bar to contain %q; got %q", want, bar)
+		}
+	}
+
+	if e := p.exchanges["bse"]; e.failed != 1 || e.total != 10 || e.rows != 2 {
+		t.Errorf("unexpected progress for bse: %+v", e)
+	}
+}
+
+func TestStatusWriter(t *testing.T) {
+	var buf bytes.Buffer
+	var w = &statusWriter{out: &buf}
+
+	_, _ = w.Write([]byte("first\n"))
+	w.setStatus("[=>  ]")
+	_, _ = w.Write([]byte("second\n"))
+	w.setStatus("")
+
+	const expected = "first\n" + "\r\033[K[=>  ]" + "\r\033[Ksecond\n[=>  ]" + "\r\033[K"
+	if buf.String() != expected {
+		t.Errorf("expected %q; got %q", expected, buf.String())
+	}
+}
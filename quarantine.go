@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	_ "embed"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"go.riyazali.net/bhav/pipeline"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+//go:embed queries/upsert_quarantine.sql
+var upsertQuarantine string // query to insert / update a row in "quarantine" table
+
+// quarantined collects the rows the pipeline couldn't parse (see pipeline.Options.OnRowError)
+type quarantined struct {
+	sync.Mutex
+	rows []*pipeline.RowError
+}
+
+func (q *quarantined) add(e *pipeline.RowError) {
+	q.Lock()
+	defer q.Unlock()
+	q.rows = append(q.rows, e)
+}
+
+// len returns the number of rows collected (and not yet saved)
+func (q *quarantined) len() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.rows)
+}
+
+// save records the collected rows in "quarantine" table, logging the number of rows quarantined per source
+func (q *quarantined) save(c *sqlite.Conn) (err error) {
+	q.Lock()
+	defer q.Unlock()
+	defer sqlitex.Save(c)(&err)
+
+	var counts = make(map[string]int)
+	var ups = c.Prep(upsertQuarantine)
+	for _, row := range q.rows {
+		ups.SetText(":source", row.Source)
+		ups.SetText(":report", row.Report)
+		ups.SetText(":trading_date", row.Date.Format("2006-01-02"))
+		ups.SetInt64(":line", int64(row.Line))
+		ups.SetText(":header", row.Header)
+		ups.SetText(":row", row.Row)
+		ups.SetText(":error", row.Err.Error())
+		if _, err = ups.Step(); err != nil {
+			_ = ups.Reset()
+			return errors.Wrapf(err, "failed to quarantine line %d of %s", row.Line, row.Report)
+		}
+		_ = ups.Reset()
+		counts[row.Source]++
+	}
+
+	for source, n := range counts {
+		log.Warn().Str("source", source).Int("count", n).Msg("quarantined rows that couldn't be parsed")
+	}
+	q.rows = nil
+	return nil
+}
+
+// retryQuarantined parses the quarantined rows again (presumably after a fix to the parser), inserting the rows that
+// can now be parsed into "equity" table (as part of the given run, which can be nil) and removing them from quarantine.
+// It returns the writer used to write the rows (with the earliest trading date written for each exchange), along with
+// the number of rows loaded and the number of rows still quarantined.
+func retryQuarantined(c *sqlite.Conn, run *syncRun) (_ *equityWriter, loaded, remaining int, err error) {
+	defer sqlitex.Save(c)(&err)
+
+	type row struct {
+		rowid                  int64
+		source, date           string
+		header, content, cause string
+	}
+
+	var rows []row
+	const query = "SELECT rowid, source, trading_date, header, row, error FROM quarantine ORDER BY report, line"
+	if err = sqlitex.Exec(c, query, func(stmt *sqlite.Stmt) error {
+		rows = append(rows, row{rowid: stmt.GetInt64("rowid"), source: stmt.GetText("source"), date: stmt.GetText("trading_date"),
+			header: stmt.GetText("header"), content: stmt.GetText("row"), cause: stmt.GetText("error")})
+		return nil
+	}); err != nil {
+		return nil, 0, 0, errors.Wrap(err, "failed to read quarantined rows")
+	}
+
+	var w = newEquityWriter(c, onConflict, run)
+	for _, r := range rows {
+		var source, ok = pipeline.Lookup(r.source)
+		if !ok {
+			log.Warn().Str("source", r.source).Msg("source not registered; skipping quarantined row")
+			remaining++
+			continue
+		}
+
+		var date, _ = time.Parse("2006-01-02", r.date)
+		var records []pipeline.Equity
+		var cause error
+		var report = strings.NewReader(r.header + "\n" + r.content)
+		err = source.Parse(report, date, func(eq pipeline.Equity) error {
+			records = append(records, eq)
+			return nil
+		}, func(e *pipeline.RowError) error { cause = e.Err; return nil })
+
+		if err == nil && cause == nil && len(records) == 0 {
+			cause = errors.New("row yields no record")
+		} else if err != nil {
+			cause = err
+		}
+
+		for i := 0; cause == nil && i < len(records); i++ {
+			cause = w.write(records[i])
+		}
+
+		if cause != nil {
+			remaining++
+			const update = "UPDATE quarantine SET error = ?, attempts = attempts + 1 WHERE rowid = ?"
+			if err = sqlitex.Exec(c, update, nil, cause.Error(), r.rowid); err != nil {
+				return nil, 0, 0, errors.Wrap(err, "failed to update quarantined row")
+			}
+			continue
+		}
+
+		loaded++
+		if err = sqlitex.Exec(c, "DELETE FROM quarantine WHERE rowid = ?", nil, r.rowid); err != nil {
+			return nil, 0, 0, errors.Wrap(err, "failed to remove row from quarantine")
+		}
+	}
+
+	return w, loaded, remaining, nil
+}
+
+// quarantine implements the `quarantine` command which lists the rows quarantined by the sync (as they couldn't be
+// parsed) and, with --retry, parses them again to load the rows that can now be parsed (after a fix to the parser).
+func quarantine(args []string) {
+	var retry bool
+
+	var flags = newFlagSet("quarantine")
+	flags.BoolVar(&retry, "retry", false, "parse the quarantined rows again, loading the rows that can now be parsed")
+	flags.Var(&onConflict, "on-conflict", "how to handle records for existing rows: skip, replace or audit")
+	_ = flags.Parse(args)
+	configureLogging()
+
+	var conn = openDatabase(filename)
+	defer conn.Close()
+
+	if retry {
+		var run, err = startRun(conn, "quarantine")
+		if err != nil {
+			log.Fatal().Err(err).Send()
+		}
+		logRun(run)
+
+		var w *equityWriter
+		var loaded, remaining int
+		w, loaded, remaining, err = retryQuarantined(conn, run)
+		if e := run.finish(w, remaining, err); e != nil {
+			log.Error().Err(e).Send()
+		}
+
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to retry quarantined rows")
+		}
+
+		log.Info().Int("loaded", loaded).Int("remaining", remaining).Msg("retried quarantined rows")
+		if loaded > 0 {
+			updateDerived(conn, w.inserted)
+		}
+		return
+	}
+
+	var tw = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "source\tdate\tline\tattempts\terror\trow")
+
+	const query = "SELECT source, trading_date, line, attempts, error, row FROM quarantine ORDER BY source, trading_date, line"
+	var err = sqlitex.Exec(conn, query, func(stmt *sqlite.Stmt) error {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n", stmt.GetText("source"), stmt.GetText("trading_date"),
+			stmt.GetInt64("line"), stmt.GetInt64("attempts"), stmt.GetText("error"), stmt.GetText("row"))
+		return nil
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to list quarantined rows")
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crawshaw.io/sqlite/sqlitex"
+	"go.riyazali.net/bhav/pipeline/fake"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuarantine(t *testing.T) {
+	var server = serve(t)
+
+	var date = time.Date(2021, 03, 05, 0, 0, 0, 0, time.UTC)
+	server.AddBse(date, fake.BseReport(date))
+	server.AddNse(date, strings.Replace(fake.NseReport(date), "3005.00,", "3,005.00,", 1)) // TCS row is malformed
+
+	var conn = openDatabase(filepath.Join(t.TempDir(), "bhavcopy.db"))
+	defer conn.Close()
+
+	var rejected = &quarantined{}
+	syncDates(conn, date, date, rejected)
+	if err := rejected.save(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, conn, "SELECT COUNT(*) FROM equity WHERE exchange = 'nse'"); n != 1 {
+		t.Errorf("expected good rows of the report to be inserted; got %d rows", n)
+	}
+
+	if n := count(t, conn, "SELECT COUNT(*) FROM quarantine WHERE source = 'nse/equity' AND line = 3 AND row LIKE 'TCS,%'"); n != 1 {
+		t.Fatalf("expected malformed row to be quarantined; got %d rows", n)
+	}
+
+	// nothing changed; row must remain in quarantine
+	if _, loaded, remaining, err := retryQuarantined(conn, nil); err != nil || loaded != 0 || remaining != 1 {
+		t.Fatalf("expected row to remain in quarantine; got loaded=%d remaining=%d err=%v", loaded, remaining, err)
+	}
+
+	// simulate a fix (to the row, instead of the parser)
+	if err := sqlitex.Exec(conn, "UPDATE quarantine SET row = REPLACE(row, '3,005.00', '3005.00')", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var w, loaded, remaining, err = retryQuarantined(conn, nil)
+	if err != nil || loaded != 1 || remaining != 0 {
+		t.Fatalf("expected row to be loaded; got loaded=%d remaining=%d err=%v", loaded, remaining, err)
+	}
+
+	if !w.inserted["nse"].Equal(date) {
+		t.Errorf("expected inserted date to be %s; got %s", date, w.inserted["nse"])
+	}
+
+	if n := count(t, conn, "SELECT COUNT(*) FROM equity WHERE exchange = 'nse' AND ticker = 'TCS' AND close = 3010"); n != 1 {
+		t.Errorf("expected quarantined row to be inserted; got %d rows", n)
+	}
+
+	if n := count(t, conn, "SELECT COUNT(*) FROM quarantine"); n != 0 {
+		t.Errorf("expected quarantine to be empty; got %d rows", n)
+	}
+}
@@ -0,0 +1,24 @@
+-- query to (re)compute higher timeframe candles for an exchange from the period containing :from onwards
+-- {{table}} and {{period}} are replaced with the target table and the expression computing start of the period
+INSERT OR REPLACE INTO {{table}} (exchange, ticker, type, period_start, first_date, last_date, open, high, low, close, volume)
+SELECT exchange,
+       ticker,
+       type,
+       period,
+       MIN(trading_date),
+       MAX(trading_date),
+       MIN(first_open),
+       MAX(high),
+       MIN(low),
+       MIN(last_close),
+       SUM(volume)
+FROM (SELECT *,
+             {{period}}                AS period,
+             FIRST_VALUE(open) OVER w AS first_open,
+             LAST_VALUE(close) OVER w AS last_close
+      FROM equity
+      WHERE exchange = :exchange
+        AND trading_date >= (SELECT {{period}} FROM (SELECT :from AS trading_date))
+          WINDOW w AS (PARTITION BY ticker, type, {{period}} ORDER BY trading_date
+              ROWS BETWEEN UNBOUNDED PRECEDING AND UNBOUNDED FOLLOWING))
+GROUP BY exchange, ticker, type, period
@@ -0,0 +1,8 @@
+-- query to return the last close price of a ticker before the given date
+-- the unary + on trading_date keeps sqlite from using range constraint on equity_ticker index,
+-- which returns incorrect results for without rowid tables in the bundled version of sqlite
+SELECT close
+FROM equity
+WHERE exchange = :exchange
+  AND ticker = :ticker
+  AND trading_date = (SELECT MAX(trading_date) FROM equity WHERE exchange = :exchange AND ticker = :ticker AND +trading_date < :date)
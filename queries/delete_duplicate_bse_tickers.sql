@@ -0,0 +1,12 @@
+-- query to delete bse rows stored under a bare scrip code when a row for the same day is already stored under
+-- the scrip's security id (for example, synced after the scrip was listed), as re-resolving would duplicate it
+DELETE
+FROM equity
+WHERE exchange = 'bse'
+  AND ticker IN (SELECT scrip_code FROM bse_company WHERE security_id <> '')
+  AND EXISTS(SELECT 1
+             FROM equity resolved
+             WHERE resolved.exchange = equity.exchange
+               AND resolved.trading_date = equity.trading_date
+               AND resolved.type = equity.type
+               AND resolved.ticker = (SELECT security_id FROM bse_company WHERE scrip_code = equity.ticker))
\ No newline at end of file
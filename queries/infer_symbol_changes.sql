@@ -0,0 +1,19 @@
+-- query to infer symbol changes using continuity of isin_code in the equity table
+-- a change from A to B is recorded if a security (identified by its isin) traded as A
+-- and then (with no other ticker in between) started trading as B
+WITH spans AS (SELECT exchange, isin_code, ticker, MIN(trading_date) AS first_date, MAX(trading_date) AS last_date
+               FROM equity
+               WHERE isin_code IS NOT NULL AND isin_code <> ''
+               GROUP BY exchange, isin_code, ticker)
+INSERT OR IGNORE INTO symbol_change (exchange, old_symbol, new_symbol, effective_date, source)
+SELECT a.exchange, a.ticker, b.ticker, b.first_date, 'isin'
+FROM spans a
+         JOIN spans b ON a.exchange = b.exchange AND a.isin_code = b.isin_code
+    AND a.ticker <> b.ticker AND a.last_date < b.first_date
+WHERE NOT EXISTS(SELECT 1
+                 FROM spans c
+                 WHERE c.exchange = a.exchange
+                   AND c.isin_code = a.isin_code
+                   AND c.ticker NOT IN (a.ticker, b.ticker)
+                   AND c.first_date > a.last_date
+                   AND c.first_date < b.first_date)
@@ -1,3 +1,4 @@
--- query to insert data into the equity table
-INSERT INTO equity (exchange, type, trading_date, ticker, isin_code, open, high, low, close, last, previous_close)
-VALUES (:exchange, :type, :trading_date, :ticker, :isin_code, :open, :high, :low, :close, :last, :previous_close);
\ No newline at end of file
+-- query to insert data into the equity table, skipping rows that already exist
+INSERT INTO equity (exchange, type, trading_date, ticker, isin_code, open, high, low, close, last, previous_close, volume, run_id)
+VALUES (:exchange, :type, :trading_date, :ticker, :isin_code, :open, :high, :low, :close, :last, :previous_close, :volume, :run_id)
+ON CONFLICT (exchange, trading_date, ticker, type) DO NOTHING
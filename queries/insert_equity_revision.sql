@@ -0,0 +1,14 @@
+-- query to record a revision to an existing row in the equity table, if the new values differ from the existing ones
+INSERT INTO equity_revision (exchange, trading_date, ticker, type, run_id,
+                             old_isin_code, old_open, old_high, old_low, old_close, old_last, old_previous_close, old_volume,
+                             new_isin_code, new_open, new_high, new_low, new_close, new_last, new_previous_close, new_volume)
+SELECT exchange, trading_date, ticker, type, :run_id,
+       isin_code, open, high, low, close, last, previous_close, volume,
+       :isin_code, :open, :high, :low, :close, :last, :previous_close, :volume
+FROM equity
+WHERE exchange = :exchange
+  AND trading_date = :trading_date
+  AND ticker = :ticker
+  AND type = :type
+  AND (isin_code, open, high, low, close, last, previous_close, volume) IS NOT
+      (:isin_code, :open, :high, :low, :close, :last, :previous_close, :volume)
@@ -0,0 +1,3 @@
+-- query to insert a symbol change into symbol_change table
+INSERT OR IGNORE INTO symbol_change (exchange, old_symbol, new_symbol, effective_date, source)
+VALUES (:exchange, :old_symbol, :new_symbol, :effective_date, :source)
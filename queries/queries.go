@@ -0,0 +1,17 @@
+// Package queries provides the sql queries shared by the tool and package store.
+// Queries used only by the tool are embedded by the tool itself.
+package queries
+
+import _ "embed"
+
+//go:embed last_trading_date_by_exchange.sql
+var LastTradingDateByExchange string // query to fetch last trading date by exchange
+
+//go:embed select_equity_history.sql
+var SelectEquityHistory string // query to fetch records of a ticker (across symbol changes) between two dates
+
+//go:embed select_equity_day.sql
+var SelectEquityDay string // query to fetch all records of an exchange on a trading date
+
+//go:embed select_instruments.sql
+var SelectInstruments string // query to list the instruments (by their current ticker) recorded in the database
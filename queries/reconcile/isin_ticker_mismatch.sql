@@ -0,0 +1,14 @@
+-- isin codes that map to differently named tickers on bse and nse (possibly a wrong scrip code mapping)
+SELECT 'bse/nse'                     AS exchange,
+       MAX(n.trading_date)           AS trading_date,
+       b.ticker || '/' || n.ticker   AS ticker,
+       ''                            AS type,
+       'isin=' || n.isin_code        AS detail
+FROM equity n
+         JOIN equity b ON b.exchange = 'bse' AND b.trading_date = n.trading_date AND b.isin_code = n.isin_code
+WHERE n.exchange = 'nse'
+  AND n.type = 'EQ'
+  AND n.trading_date >= :since
+  AND n.isin_code IS NOT NULL AND n.isin_code <> ''
+  AND b.ticker <> n.ticker
+GROUP BY n.isin_code, b.ticker, n.ticker
@@ -0,0 +1,11 @@
+-- tickers with rows that don't have an isin code (and can't be reconciled across exchanges)
+SELECT exchange,
+       MIN(trading_date)                                                                      AS trading_date,
+       ticker,
+       type,
+       PRINTF('%d rows between %s and %s', COUNT(*), MIN(trading_date), MAX(trading_date))    AS detail
+FROM equity
+WHERE trading_date >= :since
+  AND (isin_code IS NULL OR isin_code = '')
+GROUP BY exchange, ticker, type
+ORDER BY COUNT(*) DESC
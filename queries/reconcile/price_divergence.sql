@@ -0,0 +1,16 @@
+-- dual-listed securities whose bse and nse close differ by more than --threshold percent
+SELECT 'bse/nse'                                                                       AS exchange,
+       n.trading_date,
+       b.ticker || '/' || n.ticker                                                     AS ticker,
+       b.type || '/' || n.type                                                         AS type,
+       PRINTF('isin=%s bse=%g nse=%g diff=%.2f%%', n.isin_code, b.close, n.close,
+              (b.close - n.close) * 100 / n.close)                                     AS detail
+FROM equity n
+         JOIN equity b ON b.exchange = 'bse' AND b.trading_date = n.trading_date AND b.isin_code = n.isin_code
+WHERE n.exchange = 'nse'
+  AND n.type = 'EQ'
+  AND n.trading_date >= :since
+  AND n.isin_code IS NOT NULL AND n.isin_code <> ''
+  AND n.close > 0
+  AND ABS(b.close - n.close) * 100 / n.close > :threshold
+ORDER BY n.trading_date, n.ticker
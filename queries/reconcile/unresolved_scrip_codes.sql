@@ -0,0 +1,13 @@
+-- bse rows whose ticker fell back to the raw (numeric) scrip code; see `bhav refresh-masters`
+SELECT exchange,
+       MIN(trading_date)                                                                      AS trading_date,
+       ticker,
+       type,
+       PRINTF('%d rows between %s and %s', COUNT(*), MIN(trading_date), MAX(trading_date))    AS detail
+FROM equity
+WHERE exchange = 'bse'
+  AND trading_date >= :since
+  AND ticker GLOB '[0-9]*'
+  AND ticker NOT GLOB '*[^0-9]*'
+GROUP BY exchange, ticker, type
+ORDER BY COUNT(*) DESC
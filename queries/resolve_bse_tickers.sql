@@ -0,0 +1,8 @@
+-- query to re-resolve bse tickers that were stored as bare scrip codes (because the scrip code
+-- wasn't present in the list of listed companies at the time of sync) to their security id
+-- rows that would conflict with an existing row must be deleted first (see delete_duplicate_bse_tickers.sql)
+UPDATE equity
+SET ticker    = (SELECT security_id FROM bse_company WHERE scrip_code = equity.ticker),
+    isin_code = COALESCE(NULLIF(isin_code, ''), (SELECT isin_code FROM bse_company WHERE scrip_code = equity.ticker))
+WHERE exchange = 'bse'
+  AND ticker IN (SELECT scrip_code FROM bse_company WHERE security_id <> '')
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- number of trading days and tickers synced per exchange and year
+SELECT exchange, STRFTIME('%Y', trading_date) AS year, COUNT(DISTINCT trading_date) AS days, COUNT(DISTINCT ticker) AS tickers
+FROM equity
+GROUP BY exchange, year
+ORDER BY exchange, year
@@ -0,0 +1,6 @@
+-- all records on the last trading date for an exchange (params: exchange)
+SELECT *
+FROM equity
+WHERE exchange = :exchange
+  AND trading_date = (SELECT MAX(trading_date) FROM equity WHERE exchange = :exchange)
+ORDER BY ticker
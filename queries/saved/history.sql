@@ -0,0 +1,6 @@
+-- price history of a ticker, across symbol changes (params: exchange, ticker)
+SELECT trading_date, ticker, open, high, low, close, volume
+FROM equity_history
+WHERE exchange = :exchange
+  AND current_ticker = :ticker
+ORDER BY trading_date
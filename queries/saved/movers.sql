@@ -0,0 +1,8 @@
+-- top gainers and losers on a trading date (params: exchange, date)
+SELECT ticker, type, previous_close, close, ROUND((close - previous_close) * 100 / previous_close, 2) AS change
+FROM equity
+WHERE exchange = :exchange
+  AND trading_date = :date
+  AND previous_close > 0
+ORDER BY ABS(close - previous_close) / previous_close DESC
+LIMIT 20
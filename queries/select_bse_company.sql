@@ -0,0 +1,2 @@
+-- query to return bse's list of listed companies stored in the database
+SELECT scrip_code, security_id, security_name, status, isin_code FROM bse_company
@@ -0,0 +1,6 @@
+-- query to return all records of an exchange on a trading date
+SELECT *
+FROM equity_history
+WHERE exchange = :exchange
+  AND trading_date = :trading_date
+ORDER BY ticker, type
\ No newline at end of file
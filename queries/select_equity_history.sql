@@ -0,0 +1,7 @@
+-- query to return records of a ticker (by its current ticker, so spanning symbol changes) between two dates (inclusive)
+SELECT *
+FROM equity_history
+WHERE exchange = :exchange
+  AND current_ticker = :ticker
+  AND trading_date BETWEEN :from AND :to
+ORDER BY trading_date, type
\ No newline at end of file
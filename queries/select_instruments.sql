@@ -0,0 +1,10 @@
+-- query to return the instruments (by their current ticker) recorded in the database,
+-- along with the first and last trading dates and the isin code on the last trading date
+WITH instrument AS (SELECT exchange, current_ticker, type, MIN(trading_date) AS first_date, MAX(trading_date) AS last_date
+                    FROM equity_history
+                    GROUP BY exchange, current_ticker, type)
+SELECT i.exchange, i.current_ticker AS ticker, i.type, i.first_date, i.last_date, e.isin_code
+FROM instrument i
+         LEFT JOIN equity_history e ON e.exchange = i.exchange AND e.current_ticker = i.current_ticker
+    AND e.type = i.type AND e.trading_date = i.last_date
+ORDER BY i.exchange, i.current_ticker, i.type
\ No newline at end of file
@@ -0,0 +1,16 @@
+-- query to return days on which the exchange has data, but a ticker (between its first and last recorded date) doesn't
+WITH days AS (SELECT DISTINCT exchange, trading_date FROM equity WHERE trading_date >= :since),
+     spans AS (SELECT exchange, ticker, type, MIN(trading_date) AS first_date, MAX(trading_date) AS last_date
+               FROM equity
+               WHERE :ticker = '' OR ticker = :ticker
+               GROUP BY exchange, ticker, type)
+SELECT s.exchange, s.ticker, s.type, d.trading_date
+FROM spans s
+         JOIN days d ON d.exchange = s.exchange AND d.trading_date BETWEEN s.first_date AND s.last_date
+WHERE NOT EXISTS(SELECT 1
+                 FROM equity e
+                 WHERE e.exchange = s.exchange
+                   AND e.trading_date = d.trading_date
+                   AND e.ticker = s.ticker
+                   AND e.type = s.type)
+ORDER BY s.exchange, s.ticker, s.type, d.trading_date
@@ -0,0 +1,7 @@
+-- query to insert (or update) an entry in bse's list of listed companies
+INSERT INTO bse_company (scrip_code, security_id, security_name, status, isin_code)
+VALUES (:scrip_code, :security_id, :security_name, :status, :isin_code)
+ON CONFLICT (scrip_code) DO UPDATE SET security_id   = excluded.security_id,
+                                       security_name = excluded.security_name,
+                                       status        = excluded.status,
+                                       isin_code     = excluded.isin_code
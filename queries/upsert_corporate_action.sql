@@ -0,0 +1,13 @@
+-- query to insert (or update) a corporate action
+-- updating an action resets its factor so that adjustments are recomputed
+INSERT INTO corporate_action (exchange, ticker, ex_date, kind, ratio_old, ratio_new, amount, purpose, factor, adjusted)
+VALUES (:exchange, :ticker, :ex_date, :kind, :ratio_old, :ratio_new, :amount, :purpose, NULL, 0)
+ON CONFLICT (exchange, ticker, ex_date, kind) DO UPDATE SET ratio_old = excluded.ratio_old,
+                                                            ratio_new = excluded.ratio_new,
+                                                            amount    = excluded.amount,
+                                                            purpose   = excluded.purpose,
+                                                            factor    = NULL,
+                                                            adjusted  = 0
+WHERE ratio_old IS NOT excluded.ratio_old
+   OR ratio_new IS NOT excluded.ratio_new
+   OR amount IS NOT excluded.amount
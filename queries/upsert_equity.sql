@@ -0,0 +1,15 @@
+-- query to insert data into the equity table, replacing the values of an existing row (if they differ)
+INSERT INTO equity (exchange, type, trading_date, ticker, isin_code, open, high, low, close, last, previous_close, volume, run_id)
+VALUES (:exchange, :type, :trading_date, :ticker, :isin_code, :open, :high, :low, :close, :last, :previous_close, :volume, :run_id)
+ON CONFLICT (exchange, trading_date, ticker, type) DO UPDATE SET isin_code      = excluded.isin_code,
+                                                                 open           = excluded.open,
+                                                                 high           = excluded.high,
+                                                                 low            = excluded.low,
+                                                                 close          = excluded.close,
+                                                                 last           = excluded.last,
+                                                                 previous_close = excluded.previous_close,
+                                                                 volume         = excluded.volume,
+                                                                 run_id         = excluded.run_id
+WHERE (isin_code, open, high, low, close, last, previous_close, volume) IS NOT
+      (excluded.isin_code, excluded.open, excluded.high, excluded.low, excluded.close, excluded.last,
+       excluded.previous_close, excluded.volume)
@@ -0,0 +1,11 @@
+-- query to quarantine a row that couldn't be parsed
+-- quarantining the same row again (like when the same report is synced again) replaces it
+INSERT INTO quarantine (source, report, trading_date, line, header, row, error)
+VALUES (:source, :report, :trading_date, :line, :header, :row, :error)
+ON CONFLICT (report, line) DO UPDATE SET source         = excluded.source,
+                                         trading_date   = excluded.trading_date,
+                                         header         = excluded.header,
+                                         row            = excluded.row,
+                                         error          = excluded.error,
+                                         attempts       = attempts + 1,
+                                         quarantined_at = excluded.quarantined_at
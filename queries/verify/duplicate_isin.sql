@@ -0,0 +1,7 @@
+-- isin codes shared by more than one ticker on the same exchange and trading date
+SELECT exchange, trading_date, GROUP_CONCAT(DISTINCT ticker) AS ticker, '' AS type, 'isin=' || isin_code AS detail
+FROM equity
+WHERE trading_date >= :since
+  AND isin_code IS NOT NULL AND isin_code <> ''
+GROUP BY exchange, trading_date, isin_code
+HAVING COUNT(DISTINCT ticker) > 1
@@ -0,0 +1,6 @@
+-- rows with zero or negative prices
+SELECT exchange, trading_date, ticker, type,
+       PRINTF('open=%g high=%g low=%g close=%g', open, high, low, close) AS detail
+FROM equity
+WHERE trading_date >= :since
+  AND (open <= 0 OR high <= 0 OR low <= 0 OR close <= 0)
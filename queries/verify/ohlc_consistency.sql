@@ -0,0 +1,6 @@
+-- rows where open / close lie outside the [low, high] range
+SELECT exchange, trading_date, ticker, type,
+       PRINTF('open=%g high=%g low=%g close=%g', open, high, low, close) AS detail
+FROM equity
+WHERE trading_date >= :since
+  AND (high < low OR open > high OR open < low OR close > high OR close < low)
@@ -0,0 +1,9 @@
+-- rows where previous_close doesn't match close on the prior trading day (ignoring days with a corporate action)
+SELECT exchange, trading_date, ticker, type, PRINTF('previous_close=%g prior_close=%g', previous_close, prior_close) AS detail
+FROM (SELECT *, LAG(close) OVER (PARTITION BY exchange, ticker, type ORDER BY trading_date) AS prior_close
+      FROM equity) e
+WHERE trading_date >= :since
+  AND prior_close IS NOT NULL
+  AND ABS(previous_close - prior_close) > 0.005 * prior_close
+  AND NOT EXISTS(SELECT 1 FROM corporate_action ca
+                 WHERE ca.exchange = e.exchange AND ca.ticker = e.ticker AND ca.ex_date = e.trading_date)
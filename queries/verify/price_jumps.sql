@@ -0,0 +1,10 @@
+-- close moved more than --max-jump percent from the prior trading day without a corporate action
+SELECT exchange, trading_date, ticker, type, PRINTF('close=%g prior_close=%g change=%.2f%%', close, prior_close, change) AS detail
+FROM (SELECT *, (close - prior_close) * 100 / prior_close AS change
+      FROM (SELECT *, LAG(close) OVER (PARTITION BY exchange, ticker, type ORDER BY trading_date) AS prior_close
+            FROM equity)) e
+WHERE trading_date >= :since
+  AND prior_close > 0
+  AND ABS(change) > :max_jump
+  AND NOT EXISTS(SELECT 1 FROM corporate_action ca
+                 WHERE ca.exchange = e.exchange AND ca.ticker = e.ticker AND ca.ex_date = e.trading_date)
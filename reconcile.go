@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crawshaw.io/sqlite"
+	"embed"
+	"github.com/rs/zerolog/log"
+	"os"
+	"time"
+)
+
+//go:embed queries/reconcile/*.sql
+var reconcileQueries embed.FS // cross-exchange reconciliation checks
+
+// reconcile implements the `reconcile` command which compares prices of dual-listed securities (joined by isin)
+// across bse and nse, and summarises mapping problems (like bse scrip codes that couldn't be resolved).
+// The report is in the same format as the one produced by the `verify` command.
+func reconcile(args []string) {
+	var since date
+	var threshold float64
+	var limit int
+	var output string
+
+	var flags = newFlagSet("reconcile")
+	flags.Var(&since, "since", "only reconcile data on / after this date")
+	flags.Float64Var(&threshold, "threshold", 5, "maximum difference (in percent) between bse and nse close")
+	flags.IntVar(&limit, "limit", 100, "maximum number of divergences to report per check")
+	flags.StringVar(&output, "output", "-", "file to write the report to (- for stdout)")
+	_ = flags.Parse(args)
+	configureLogging()
+
+	var conn = openDatabase(filename)
+	defer conn.Close()
+
+	var report, err = reconcileDatabase(conn, reconcileOptions{since: time.Time(since), threshold: threshold, limit: limit})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to reconcile exchanges")
+	}
+
+	if err = writeReport(report, output); err != nil {
+		log.Fatal().Err(err).Msg("failed to write report")
+	}
+
+	logReport(report)
+	if !report.Passed {
+		_ = conn.Close()
+		os.Exit(1)
+	}
+}
+
+// reconcileOptions configures the cross-exchange reconciliation checks
+type reconcileOptions struct {
+	since     time.Time // only reconcile rows on / after this date
+	threshold float64   // maximum difference (in percent) between bse and nse close
+	limit     int       // maximum number of divergences to report per check
+}
+
+// reconcileDatabase runs all cross-exchange reconciliation checks against the database
+func reconcileDatabase(c *sqlite.Conn, opts reconcileOptions) (*Report, error) {
+	var report = &Report{Database: filename, GeneratedAt: time.Now(), Since: opts.since.Format("2006-01-02"), Passed: true}
+
+	var params = map[string]interface{}{"since": report.Since, "threshold": opts.threshold}
+	var results, err = runChecks(c, reconcileQueries, "queries/reconcile/*.sql", params, opts.limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		report.add(result)
+	}
+	return report, nil
+}
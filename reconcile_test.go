@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crawshaw.io/sqlite/sqlitex"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReconcile(t *testing.T) {
+	var conn = openDatabase(filepath.Join(t.TempDir(), "bhavcopy.db"))
+	defer conn.Close()
+
+	// INFY's closes differ by 10% on 2nd (and 1% on 1st); TCS is listed with a different ticker on bse;
+	// 532540 is a bse row under a bare scrip code (without an isin), and rows before 1st are out of range
+	const rows = `INSERT INTO equity (exchange, trading_date, ticker, type, isin_code, close)
+		VALUES ('nse', '2021-03-01', 'INFY', 'EQ', 'INE009A01021', 100), ('bse', '2021-03-01', 'INFY', 'A', 'INE009A01021', 101),
+		       ('nse', '2021-03-02', 'INFY', 'EQ', 'INE009A01021', 100), ('bse', '2021-03-02', 'INFY', 'A', 'INE009A01021', 110),
+		       ('nse', '2021-02-26', 'INFY', 'EQ', 'INE009A01021', 100), ('bse', '2021-02-26', 'INFY', 'A', 'INE009A01021', 150),
+		       ('nse', '2021-03-01', 'TCS', 'EQ', 'INE467B01029', 3000), ('bse', '2021-03-01', 'TCSLTD', 'A', 'INE467B01029', 3000),
+		       ('bse', '2021-03-01', '532540', 'A', '', 3000), ('bse', '2021-03-02', '532540', 'A', '', 3000)`
+	if err := sqlitex.ExecScript(conn, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	var since = time.Date(2021, 03, 01, 0, 0, 0, 0, time.UTC)
+	var report, err = reconcileDatabase(conn, reconcileOptions{since: since, threshold: 5, limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Passed {
+		t.Errorf("expected the report to fail")
+	}
+
+	var checks = make(map[string]CheckResult)
+	for _, check := range report.Checks {
+		checks[check.Name] = check
+	}
+
+	var divergence = checks["price_divergence"]
+	if divergence.Count != 1 {
+		t.Errorf("expected a single price divergence; got %+v", divergence)
+	} else if v := divergence.Violations[0]; v.TradingDate != "2021-03-02" || v.Ticker != "INFY/INFY" ||
+		v.Detail != "isin=INE009A01021 bse=110 nse=100 diff=10.00%" {
+		t.Errorf("expected INFY to diverge on 2021-03-02; got %+v", v)
+	}
+
+	if mismatch := checks["isin_ticker_mismatch"]; mismatch.Count != 1 || mismatch.Violations[0].Ticker != "TCSLTD/TCS" {
+		t.Errorf("expected TCS to be listed under different tickers; got %+v", mismatch)
+	}
+
+	var unresolved = checks["unresolved_scrip_codes"]
+	if unresolved.Count != 1 || unresolved.Violations[0].Ticker != "532540" ||
+		unresolved.Violations[0].Detail != "2 rows between 2021-03-01 and 2021-03-02" {
+		t.Errorf("expected a single unresolved scrip code; got %+v", unresolved)
+	}
+
+	if missing := checks["missing_isin"]; missing.Count != 1 || missing.Violations[0].Ticker != "532540" {
+		t.Errorf("expected only the scrip code to be missing an isin; got %+v", missing)
+	}
+
+	// with a higher threshold, INFY's closes don't diverge
+	if report, err = reconcileDatabase(conn, reconcileOptions{since: since, threshold: 15, limit: 100}); err != nil {
+		t.Fatal(err)
+	}
+	for _, check := range report.Checks {
+		if check.Name == "price_divergence" && check.Count != 0 {
+			t.Errorf("expected no price divergence with a 15%% threshold; got %+v", check)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// version of the tool; set at build time using -ldflags "-X main.version=v1.2.3"
+var version string
+
+// toolVersion returns the version of the tool, falling back to the version (or vcs revision) of the main module
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+
+		if v := info.Main.Version; v != "" && v != "(devel)" {
+			return v
+		}
+	}
+	return "dev"
+}
+
+// syncRun is a run of the tool that writes to "equity" table (see "sync_run" table)
+type syncRun struct {
+	id   int64
+	conn *sqlite.Conn
+}
+
+// startRun records the start of a new run of the given command
+func startRun(c *sqlite.Conn, command string) (_ *syncRun, err error) {
+	var args, _ = json.Marshal(os.Args[1:])
+
+	const query = "INSERT INTO sync_run (command, version, arguments) VALUES (?, ?, ?)"
+	if err = sqlitex.Exec(c, query, nil, command, toolVersion(), string(args)); err != nil {
+		return nil, errors.Wrap(err, "failed to record sync run")
+	}
+	return &syncRun{id: c.LastInsertRowID(), conn: c}, nil
+}
+
+// logRun adds the id of the run to every line logged afterwards (by the global logger)
+func logRun(r *syncRun) { log.Logger = log.With().Int64("run", r.id).Logger() }
+
+// addRange records the range of dates synced by the run for the exchange
+func (r *syncRun) addRange(exchange string, from, to time.Time) error {
+	const query = "INSERT OR REPLACE INTO sync_run_range (run_id, exchange, from_date, to_date) VALUES (?, ?, ?, ?)"
+	return errors.Wrap(sqlitex.Exec(r.conn, query, nil, r.id, exchange, from.Format("2006-01-02"), to.Format("2006-01-02")),
+		"failed to record range of sync run")
+}
+
+// finish records the outcome of the run, with the counts from the writer (if not nil) and the number of rows quarantined.
+// The run is recorded as failed if cause is not nil.
+func (r *syncRun) finish(w *equityWriter, quarantined int, cause error) error {
+	var status, message = "succeeded", ""
+	if cause != nil {
+		status, message = "failed", cause.Error()
+	}
+
+	if w == nil {
+		w = &equityWriter{}
+	}
+
+	const query = `UPDATE sync_run SET finished_at = CURRENT_TIMESTAMP, status = ?, error = NULLIF(?, ''),
+		written = ?, skipped = ?, revised = ?, failed = ?, quarantined = ? WHERE id = ?`
+	return errors.Wrap(sqlitex.Exec(r.conn, query, nil, status, message, w.written, w.skipped, w.revised, w.failed, quarantined, r.id),
+		"failed to record outcome of sync run")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"go.riyazali.net/bhav/pipeline"
+	"go.riyazali.net/bhav/pipeline/fake"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSyncRun(t *testing.T) {
+	var date = time.Date(2021, 03, 05, 0, 0, 0, 0, time.UTC)
+	var server = serve(t)
+	server.AddNse(date, fake.NseReport(date)+"garbage,row\n")
+
+	var conn = openDatabase(filepath.Join(t.TempDir(), "bhavcopy.db"))
+	defer conn.Close()
+
+	var run, err = startRun(conn, "sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var source, _ = pipeline.Lookup("nse/equity")
+	if err = run.addRange(source.Exchange, date, date); err != nil {
+		t.Fatal(err)
+	}
+
+	var rejected = &quarantined{}
+	var w = newEquityWriter(conn, onConflict, run)
+	if _, err = syncEquities(context.Background(), []pipeline.Job{{Source: source, Dates: []time.Time{date}}}, w, rejected); err != nil {
+		t.Fatal(err)
+	}
+	if err = run.finish(w, rejected.len(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	const query = "SELECT command, version, status, finished_at, written, quarantined FROM sync_run WHERE id = ?"
+	if err = sqlitex.Exec(conn, query, func(stmt *sqlite.Stmt) error {
+		if command, status := stmt.GetText("command"), stmt.GetText("status"); command != "sync" || status != "succeeded" {
+			t.Errorf("expected a succeeded sync run; got %s run with status %s", command, status)
+		}
+		if stmt.GetText("version") == "" || stmt.GetText("finished_at") == "" {
+			t.Errorf("expected version and finish time to be recorded")
+		}
+		if written, quarantined := stmt.GetInt64("written"), stmt.GetInt64("quarantined"); written != 2 || quarantined != 1 {
+			t.Errorf("expected 2 rows written and 1 quarantined; got %d and %d", written, quarantined)
+		}
+		return nil
+	}, run.id); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, conn, "SELECT COUNT(*) FROM sync_run_range WHERE exchange = 'nse' AND from_date = '2021-03-05'"); n != 1 {
+		t.Errorf("expected range of the run to be recorded")
+	}
+
+	if n := count(t, conn, "SELECT COUNT(*) FROM equity WHERE run_id IS NOT NULL"); n != 2 {
+		t.Errorf("expected rows to reference the run; got %d", n)
+	}
+}
@@ -4,57 +4,322 @@ package schema
 import (
 	"crawshaw.io/sqlite"
 	"crawshaw.io/sqlite/sqlitex"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"io/fs"
-	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 //go:embed *.sql
 var migrations embed.FS // embedded migration scripts
 
+// Migration is a schema migration, applied by the script vN.sql and (optionally) rolled back by the script vN.down.sql
+type Migration struct {
+	Version  int64
+	Name     string // name of the script applying the migration, like v1.sql
+	Up       string // script applying the migration
+	Down     string // script rolling back the migration; empty if the migration can't be rolled back
+	Checksum string // sha256 checksum of the script applying the migration (hex-encoded)
+}
+
+// MigrationStatus is the status of a migration in a database (see Status)
+type MigrationStatus struct {
+	*Migration
+	Applied   bool
+	AppliedAt string // time the migration was applied at; empty if not recorded
+	Recorded  string // checksum of the script when the migration was applied; empty if not recorded
+}
+
+// Modified reports whether the script was modified after the migration was applied
+func (s *MigrationStatus) Modified() bool { return s.Recorded != "" && s.Recorded != s.Checksum }
+
+// Migrations returns the migrations embedded in the package, ordered by version
+func Migrations() ([]*Migration, error) { return load(migrations) }
+
+var scriptName = regexp.MustCompile(`^v([1-9][0-9]*)(\.down)?\.sql$`)
+
+// load reads the migration scripts in fsys. Scripts must be named vN.sql (or vN.down.sql) with versions starting at 1,
+// and without gaps, so that a database's user_version always identifies the migrations applied to it.
+func load(fsys fs.FS) (_ []*Migration, err error) {
+	var entries []fs.DirEntry
+	if entries, err = fs.ReadDir(fsys, "."); err != nil {
+		return nil, errors.Wrap(err, "failed to list migrations")
+	}
+
+	var byVersion = make(map[int64]*Migration)
+	var downs = make(map[int64]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		var match = scriptName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, errors.Errorf("invalid migration file name %q; expected vN.sql or vN.down.sql", entry.Name())
+		}
+
+		var version int64
+		if version, err = strconv.ParseInt(match[1], 10, 64); err != nil {
+			return nil, errors.Wrapf(err, "invalid migration file name %q", entry.Name())
+		}
+
+		var buf []byte
+		if buf, err = fs.ReadFile(fsys, entry.Name()); err != nil {
+			return nil, errors.Wrapf(err, "failed to read migration(%s)", entry.Name())
+		}
+		// normalise line endings so that the checksum doesn't depend on how the file was checked out
+		var script = strings.ReplaceAll(string(buf), "\r\n", "\n")
+
+		if match[2] != "" {
+			downs[version] = script
+			continue
+		}
+
+		var sum = sha256.Sum256([]byte(script))
+		byVersion[version] = &Migration{Version: version, Name: entry.Name(), Up: script, Checksum: hex.EncodeToString(sum[:])}
+	}
+
+	for version, script := range downs {
+		if byVersion[version] == nil {
+			return nil, errors.Errorf("rollback script v%d.down.sql has no migration v%d.sql", version, version)
+		}
+		byVersion[version].Down = script
+	}
+
+	var all = make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		all = append(all, migration)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+
+	for i, migration := range all {
+		if migration.Version != int64(i+1) {
+			return nil, errors.Errorf("migration v%d is missing", i+1)
+		}
+	}
+
+	return all, nil
+}
+
+// Version returns the version of the last migration applied to the primary database (its user_version)
+func Version(c *sqlite.Conn) (v int64, err error) {
+	err = sqlitex.Exec(c, "PRAGMA user_version", func(stmt *sqlite.Stmt) error { v = stmt.GetInt64("user_version"); return nil })
+	return v, errors.Wrap(err, "failed to read migration version")
+}
+
+func setVersion(c *sqlite.Conn, v int64) error {
+	return errors.Wrapf(sqlitex.Exec(c, fmt.Sprintf("PRAGMA user_version = %d", v), nil), "failed to update version to v%d", v)
+}
+
+// Table 'schema_migration' records the migrations applied to the database along with the checksum of their scripts.
+// It's created outside the migrations, as it has to record the migrations applied before it existed.
+const createMigrationTable = `CREATE TABLE IF NOT EXISTS schema_migration
+(
+    version    INTEGER PRIMARY KEY,
+    name       TEXT NOT NULL,
+    checksum   TEXT NOT NULL,
+    applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// Status returns the status of each known migration in the primary database. It doesn't modify the database.
+func Status(c *sqlite.Conn) (_ []*MigrationStatus, err error) {
+	var all []*Migration
+	if all, err = Migrations(); err != nil {
+		return nil, err
+	}
+
+	var current int64
+	if current, err = Version(c); err != nil {
+		return nil, err
+	}
+
+	var status = make([]*MigrationStatus, len(all))
+	var byVersion = make(map[int64]*MigrationStatus)
+	for i, migration := range all {
+		status[i] = &MigrationStatus{Migration: migration, Applied: migration.Version <= current}
+		byVersion[migration.Version] = status[i]
+	}
+
+	var exists bool
+	const query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migration'"
+	if err = sqlitex.Exec(c, query, func(stmt *sqlite.Stmt) error { exists = stmt.ColumnInt(0) > 0; return nil }); err != nil {
+		return nil, errors.Wrap(err, "failed to read applied migrations")
+	}
+
+	if exists {
+		err = sqlitex.Exec(c, "SELECT version, checksum, applied_at FROM schema_migration", func(stmt *sqlite.Stmt) error {
+			if s, ok := byVersion[stmt.GetInt64("version")]; ok {
+				s.Recorded, s.AppliedAt = stmt.GetText("checksum"), stmt.GetText("applied_at")
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read applied migrations")
+		}
+	}
+
+	return status, nil
+}
+
+// Pending returns the migrations not yet applied to the primary database, ordered by version
+func Pending(c *sqlite.Conn) (_ []*Migration, err error) {
+	var all []*Migration
+	if all, err = Migrations(); err != nil {
+		return nil, err
+	}
+
+	var current int64
+	if current, err = Version(c); err != nil {
+		return nil, err
+	}
+
+	var pending []*Migration
+	for _, migration := range all {
+		if migration.Version > current {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
 // Apply applies all the pending schema migrations to the primary database
 // in the provided sqlite connection. It increments the user_version and set
 // it to the latest value for the last migration that was executed.
+//
+// The checksum of each migration's script is recorded in "schema_migration" table, and Apply fails without applying
+// any migration if the script of an applied migration has been modified since. Migrations applied before
+// checksums were recorded are recorded with the checksum of their current script.
 func Apply(c *sqlite.Conn) (err error) {
 	defer sqlitex.Save(c)(&err) // migrations are transactional!
 
-	var getVersion = func() int64 {
-		var v int64
-		_ = sqlitex.Exec(c, "PRAGMA user_version",
-			func(stmt *sqlite.Stmt) error { v = stmt.GetInt64("user_version"); return nil })
-		return v
+	if err = sqlitex.ExecTransient(c, createMigrationTable, nil); err != nil {
+		return errors.Wrap(err, "failed to create migration table")
 	}
 
-	var setVersion = func(v int64) error {
-		return sqlitex.Exec(c, fmt.Sprintf("PRAGMA user_version = %d", v), nil)
+	var status []*MigrationStatus
+	if status, err = Status(c); err != nil {
+		return err
 	}
 
-	log.Debug().Msgf("current migration version is v%d", getVersion())
-	var current int64 = 0 // currently processing migration
+	var current int64
+	if current, err = Version(c); err != nil {
+		return err
+	}
+	log.Debug().Msgf("current migration version is v%d", current)
 
-	// for each file in the directory, we read+apply it returning error if any
-	return fs.WalkDir(migrations, ".", func(path string, entry fs.DirEntry, _ error) error {
-		if entry.IsDir() {
-			return nil
+	if n := int64(len(status)); current > n {
+		log.Warn().Msgf("database is at migration v%d, newer than the latest known migration v%d", current, n)
+	}
+
+	for _, s := range status {
+		if s.Modified() {
+			return errors.Errorf("migration %s was modified after it was applied (checksum %s, recorded %s)", s.Name, s.Checksum, s.Recorded)
 		}
 
-		_, _ = fmt.Sscanf(entry.Name(), "v%d.sql", &current)
-		if current <= getVersion() { // skip this migration if its already applied
-			log.Debug().Str("file", entry.Name()).Msgf("skipping version v%d", current)
-			return nil
+		if s.Applied && s.Recorded == "" { // applied before checksums were recorded
+			log.Debug().Str("file", s.Name).Msgf("recording checksum of version v%d", s.Version)
+			if err = record(c, s.Migration); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, s := range status {
+		if s.Applied { // skip this migration if its already applied
+			log.Debug().Str("file", s.Name).Msgf("skipping version v%d", s.Version)
+			continue
+		}
+
+		log.Debug().Str("file", s.Name).Msgf("applying script version v%d", s.Version)
+		if err = sqlitex.ExecScript(c, s.Up); err != nil {
+			return errors.Wrapf(err, "failed to apply migration(%s)", s.Name)
+		}
+
+		if err = record(c, s.Migration); err != nil {
+			return err
+		}
+
+		if err = setVersion(c, s.Version); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// record records the migration as applied in "schema_migration" table
+func record(c *sqlite.Conn, m *Migration) error {
+	const query = "INSERT OR REPLACE INTO schema_migration (version, name, checksum) VALUES (?, ?, ?)"
+	return errors.Wrapf(sqlitex.Exec(c, query, nil, m.Version, m.Name, m.Checksum), "failed to record migration(%s)", m.Name)
+}
+
+// Rollback rolls back the migrations applied to the primary database after the given version, in reverse order,
+// using their vN.down.sql scripts. It fails without rolling back any migration if one of those can't be rolled back.
+func Rollback(c *sqlite.Conn, to int64) (err error) {
+	defer sqlitex.Save(c)(&err)
+
+	var rollback []*Migration
+	if rollback, err = RollbackPlan(c, to); err != nil {
+		return err
+	}
+
+	if err = sqlitex.ExecTransient(c, createMigrationTable, nil); err != nil {
+		return errors.Wrap(err, "failed to create migration table")
+	}
+
+	for _, migration := range rollback {
+		log.Debug().Str("file", migration.Name).Msgf("rolling back version v%d", migration.Version)
+		if err = sqlitex.ExecScript(c, migration.Down); err != nil {
+			return errors.Wrapf(err, "failed to roll back migration(%s)", migration.Name)
 		}
 
-		var file, _ = migrations.Open(path)
-		var buf, _ = ioutil.ReadAll(file)
+		const query = "DELETE FROM schema_migration WHERE version = ?"
+		if err = sqlitex.Exec(c, query, nil, migration.Version); err != nil {
+			return errors.Wrapf(err, "failed to remove record of migration(%s)", migration.Name)
+		}
 
-		log.Debug().Str("file", entry.Name()).Msgf("applying script version v%d", current)
-		if e := sqlitex.ExecScript(c, string(buf)); e != nil {
-			return errors.Wrapf(e, "failed to apply migration(%s)", entry.Name())
+		if err = setVersion(c, migration.Version-1); err != nil {
+			return err
 		}
+	}
 
-		return errors.Wrapf(setVersion(current), "failed to update version to v%d", current)
-	})
+	return nil
+}
+
+// RollbackPlan returns the migrations Rollback would roll back (to the given version), in the order it would roll them back
+func RollbackPlan(c *sqlite.Conn, to int64) (_ []*Migration, err error) {
+	var all []*Migration
+	if all, err = Migrations(); err != nil {
+		return nil, err
+	}
+
+	var current int64
+	if current, err = Version(c); err != nil {
+		return nil, err
+	}
+
+	if to < 0 || to > current {
+		return nil, errors.Errorf("can't roll back to v%d; database is at v%d", to, current)
+	}
+
+	if current > int64(len(all)) {
+		return nil, errors.Errorf("can't roll back migration v%d; it's newer than the latest known migration v%d", current, len(all))
+	}
+
+	var rollback []*Migration
+	for v := current; v > to; v-- {
+		var migration = all[v-1]
+		if migration.Down == "" {
+			return nil, errors.Errorf("migration %s can't be rolled back (no v%d.down.sql)", migration.Name, v)
+		}
+		rollback = append(rollback, migration)
+	}
+	return rollback, nil
 }
@@ -0,0 +1,150 @@
+package schema
+
+import (
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func open(t *testing.T) *sqlite.Conn {
+	t.Helper()
+	var conn, err = sqlite.OpenConn(":memory:", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func count(t *testing.T, conn *sqlite.Conn, query string) (n int) {
+	t.Helper()
+	if err := sqlitex.Exec(conn, query, func(stmt *sqlite.Stmt) error { n = stmt.ColumnInt(0); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestLoad(t *testing.T) {
+	var script = &fstest.MapFile{Data: []byte("SELECT 1")}
+
+	var all, err = load(fstest.MapFS{"v1.sql": script, "v2.sql": script, "v10.sql": script, "v2.down.sql": script,
+		"v3.sql": script, "v4.sql": script, "v5.sql": script, "v6.sql": script, "v7.sql": script, "v8.sql": script, "v9.sql": script})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, migration := range all {
+		if migration.Version != int64(i+1) {
+			t.Errorf("expected migration %d to be v%d; got %s", i, i+1, migration.Name)
+		}
+		if (migration.Down != "") != (migration.Version == 2) {
+			t.Errorf("unexpected rollback script for %s", migration.Name)
+		}
+	}
+
+	var invalid = []fstest.MapFS{
+		{"v1.sql": script, "v01.sql": script},
+		{"v1.sql": script, "v1_fix.sql": script},
+		{"v1.sql": script, "v3.sql": script},
+		{"v1.sql": script, "v2.down.sql": script},
+	}
+	for _, fsys := range invalid {
+		if _, err = load(fsys); err == nil {
+			t.Errorf("expected error loading %v", fsys)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	var conn = open(t)
+	var all, _ = Migrations()
+	var latest = int64(len(all))
+
+	if pending, _ := Pending(conn); len(pending) != len(all) {
+		t.Errorf("expected all migrations to be pending; got %d", len(pending))
+	}
+
+	for i := 0; i < 2; i++ { // applying again must be a no-op
+		if err := Apply(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if v, _ := Version(conn); v != latest {
+		t.Errorf("expected version v%d; got v%d", latest, v)
+	}
+
+	var status, err = Status(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if !s.Applied || s.Recorded != s.Checksum || s.AppliedAt == "" {
+			t.Errorf("expected %s to be applied and recorded; got %+v", s.Name, s)
+		}
+	}
+
+	// migrations applied before checksums were recorded are recorded
+	_ = sqlitex.Exec(conn, "DELETE FROM schema_migration", nil)
+	if err = Apply(conn); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, conn, "SELECT COUNT(*) FROM schema_migration"); n != len(all) {
+		t.Errorf("expected %d recorded migrations; got %d", len(all), n)
+	}
+
+	// a modified script must be detected
+	_ = sqlitex.Exec(conn, "UPDATE schema_migration SET checksum = 'tampered' WHERE version = 1", nil)
+	if err = Apply(conn); err == nil || !strings.Contains(err.Error(), "v1.sql was modified") {
+		t.Errorf("expected modified script to be detected; got %v", err)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	var conn = open(t)
+	var all, _ = Migrations()
+	var latest = int64(len(all))
+
+	if err := Apply(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	const insert = "INSERT INTO equity (exchange, trading_date, ticker, type, close, volume) VALUES ('nse', '2021-03-05', 'INFY', 'EQ', 1310, 100)"
+	if err := sqlitex.Exec(conn, insert, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// v6 can't be rolled back, so rolling back to v5 must fail without rolling back anything
+	if err := Rollback(conn, 5); err == nil {
+		t.Errorf("expected rolling back v6 to fail")
+	}
+	if v, _ := Version(conn); v != latest {
+		t.Errorf("expected version to remain v%d; got v%d", latest, v)
+	}
+
+	if err := Rollback(conn, 6); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := Version(conn); v != 6 {
+		t.Errorf("expected version v6; got v%d", v)
+	}
+	if n := count(t, conn, "SELECT COUNT(*) FROM sqlite_master WHERE name IN ('quarantine', 'equity_revision', 'sync_run')"); n != 0 {
+		t.Errorf("expected tables added after v6 to be dropped")
+	}
+	if n := count(t, conn, "SELECT COUNT(*) FROM pragma_table_info('equity') WHERE name = 'run_id'"); n != 0 {
+		t.Errorf("expected equity.run_id to be dropped")
+	}
+	if n := count(t, conn, "SELECT COUNT(*) FROM equity_history WHERE ticker = 'INFY' AND volume = 100"); n != 1 {
+		t.Errorf("expected rows in equity to be kept")
+	}
+
+	if err := Apply(conn); err != nil { // rolled back migrations can be applied again
+		t.Fatal(err)
+	}
+	if v, _ := Version(conn); v != latest {
+		t.Errorf("expected version v%d; got v%d", latest, v)
+	}
+}
@@ -0,0 +1,12 @@
+-- This migration adds a table to store BSE's master list of listed companies.
+-- The list is embedded into the binary at build time, but can be refreshed at runtime
+-- (using `bhav refresh-masters`) so that newer listings resolve to their security id.
+
+CREATE TABLE bse_company
+(
+    scrip_code    TEXT NOT NULL PRIMARY KEY,
+    security_id   TEXT NOT NULL,
+    security_name TEXT,
+    status        TEXT,
+    isin_code     TEXT
+) WITHOUT ROWID;
@@ -0,0 +1,58 @@
+-- This migration adds support to track changes to a security's ticker over time,
+-- either published by the exchange or inferred from the continuity of isin_code in the "equity" table.
+
+-- Table 'symbol_change' records a ticker being renamed to a new ticker on the given date
+CREATE TABLE symbol_change
+(
+    exchange       TEXT NOT NULL CHECK (exchange IN ('bse', 'nse')),
+    old_symbol     TEXT NOT NULL,
+    new_symbol     TEXT NOT NULL,
+    effective_date TEXT NOT NULL CHECK (effective_date IS DATE(effective_date)),
+
+    -- source of this record; 'exchange' if published by the exchange, 'isin' if inferred using isin_code
+    source         TEXT NOT NULL CHECK (source IN ('exchange', 'isin')),
+
+    PRIMARY KEY (exchange, old_symbol, new_symbol, effective_date)
+) WITHOUT ROWID;
+
+CREATE INDEX symbol_change_new_symbol ON symbol_change (exchange, new_symbol);
+
+-- View 'ticker_identity' resolves every historical ticker (that has ever been renamed) to its current ticker,
+-- following chain of renames (A -> B -> C) in order of their effective date. A ticker that's been renamed more than once
+-- has a row per rename; rows traded in [since, until) under the ticker resolve to the rename's current ticker.
+CREATE VIEW ticker_identity AS
+WITH RECURSIVE chain (exchange, ticker, renamed_on, current_ticker, effective_date) AS (
+    SELECT exchange, old_symbol, effective_date, new_symbol, effective_date
+    FROM symbol_change
+    UNION
+    SELECT chain.exchange, chain.ticker, chain.renamed_on, sc.new_symbol, sc.effective_date
+    FROM chain
+             JOIN symbol_change sc ON sc.exchange = chain.exchange
+        AND sc.old_symbol = chain.current_ticker
+        AND sc.effective_date > chain.effective_date
+),
+     renames (exchange, ticker, renamed_on, current_ticker) AS (
+         SELECT exchange, ticker, renamed_on, MIN(current_ticker) -- a single current ticker per rename
+         FROM chain c
+         WHERE NOT EXISTS(SELECT 1
+                          FROM symbol_change sc
+                          WHERE sc.exchange = c.exchange
+                            AND sc.old_symbol = c.current_ticker
+                            AND sc.effective_date > c.effective_date)
+           AND c.ticker <> c.current_ticker
+         GROUP BY exchange, ticker, renamed_on
+     )
+SELECT exchange,
+       ticker,
+       current_ticker,
+       LAG(renamed_on, 1, '') OVER (PARTITION BY exchange, ticker ORDER BY renamed_on) AS since,
+       renamed_on                                                                      AS until
+FROM renames;
+
+-- View 'equity_history' adds the current ticker to each row in "equity" table,
+-- allowing a single query (WHERE current_ticker = ?) to span the full history of a security across renames.
+CREATE VIEW equity_history AS
+SELECT e.*, COALESCE(ti.current_ticker, e.ticker) AS current_ticker
+FROM equity e
+         LEFT JOIN ticker_identity ti ON ti.exchange = e.exchange AND ti.ticker = e.ticker
+    AND e.trading_date >= ti.since AND e.trading_date < ti.until;
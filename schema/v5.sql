@@ -0,0 +1,57 @@
+-- This migration adds support for corporate actions and prices adjusted for them.
+
+-- Table 'corporate_action' stores actions (splits, bonuses, dividends and rights issues)
+-- that affect the price of a security on and after the ex-date
+CREATE TABLE corporate_action
+(
+    exchange  TEXT NOT NULL CHECK (exchange IN ('bse', 'nse')),
+    ticker    TEXT NOT NULL,
+    ex_date   TEXT NOT NULL CHECK (ex_date IS DATE(ex_date)),
+    kind      TEXT NOT NULL CHECK (kind IN ('split', 'bonus', 'dividend', 'rights')),
+
+    -- meaning of these values depend on kind of the action (see pipeline.CorporateAction)
+    ratio_old FLOAT,
+    ratio_new FLOAT,
+    amount    FLOAT,
+    purpose   TEXT,
+
+    -- price adjustment factor for this action; applies to prices before the ex-date
+    -- it is NULL until it can be computed (dividends and rights need the close price before ex-date)
+    factor    FLOAT,
+
+    -- set once the factor is reflected in 'equity_adjustment' table
+    adjusted  INTEGER NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (exchange, ticker, ex_date, kind)
+) WITHOUT ROWID;
+
+-- Table 'equity_adjustment' stores cumulative adjustment factor for a ticker over [from_date, to_date) ranges.
+-- It is derived from 'corporate_action' table and recomputed incrementally after each sync.
+CREATE TABLE equity_adjustment
+(
+    exchange  TEXT  NOT NULL,
+    ticker    TEXT  NOT NULL,
+    from_date TEXT  NOT NULL,
+    to_date   TEXT  NOT NULL,
+    factor    FLOAT NOT NULL,
+
+    PRIMARY KEY (exchange, ticker, from_date)
+) WITHOUT ROWID;
+
+-- View 'equity_adjusted' exposes prices from 'equity' table adjusted for corporate actions
+CREATE VIEW equity_adjusted AS
+SELECT e.exchange,
+       e.trading_date,
+       e.ticker,
+       e.type,
+       e.isin_code,
+       e.open * COALESCE(a.factor, 1)           AS open,
+       e.high * COALESCE(a.factor, 1)           AS high,
+       e.low * COALESCE(a.factor, 1)            AS low,
+       e.close * COALESCE(a.factor, 1)          AS close,
+       e.last * COALESCE(a.factor, 1)           AS last,
+       e.previous_close * COALESCE(a.factor, 1) AS previous_close,
+       COALESCE(a.factor, 1)                    AS factor
+FROM equity e
+         LEFT JOIN equity_adjustment a ON a.exchange = e.exchange AND a.ticker = e.ticker
+    AND e.trading_date >= a.from_date AND e.trading_date < a.to_date;
@@ -0,0 +1,56 @@
+-- This migration adds traded volume to "equity" table and tables to store higher timeframe candles
+
+ALTER TABLE equity ADD COLUMN volume INTEGER; -- total traded quantity; NULL for rows synced before this migration
+
+-- Tables 'equity_weekly', 'equity_monthly' and 'equity_yearly' store candles aggregated from daily "equity" rows.
+-- They are maintained incrementally by the sync. The period_start is the first day (monday for weeks) of the period.
+CREATE TABLE equity_weekly
+(
+    exchange     TEXT NOT NULL,
+    ticker       TEXT NOT NULL,
+    type         TEXT NOT NULL,
+    period_start TEXT NOT NULL,
+    first_date   TEXT NOT NULL, -- first trading date in the period
+    last_date    TEXT NOT NULL, -- last trading date in the period
+    open         FLOAT,
+    high         FLOAT,
+    low          FLOAT,
+    close        FLOAT,
+    volume       INTEGER,
+
+    PRIMARY KEY (exchange, ticker, type, period_start)
+) WITHOUT ROWID;
+
+CREATE TABLE equity_monthly
+(
+    exchange     TEXT NOT NULL,
+    ticker       TEXT NOT NULL,
+    type         TEXT NOT NULL,
+    period_start TEXT NOT NULL,
+    first_date   TEXT NOT NULL,
+    last_date    TEXT NOT NULL,
+    open         FLOAT,
+    high         FLOAT,
+    low          FLOAT,
+    close        FLOAT,
+    volume       INTEGER,
+
+    PRIMARY KEY (exchange, ticker, type, period_start)
+) WITHOUT ROWID;
+
+CREATE TABLE equity_yearly
+(
+    exchange     TEXT NOT NULL,
+    ticker       TEXT NOT NULL,
+    type         TEXT NOT NULL,
+    period_start TEXT NOT NULL,
+    first_date   TEXT NOT NULL,
+    last_date    TEXT NOT NULL,
+    open         FLOAT,
+    high         FLOAT,
+    low          FLOAT,
+    close        FLOAT,
+    volume       INTEGER,
+
+    PRIMARY KEY (exchange, ticker, type, period_start)
+) WITHOUT ROWID;
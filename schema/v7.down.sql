@@ -0,0 +1,3 @@
+-- This script rolls back v7.sql, dropping the quarantined rows
+
+DROP TABLE quarantine;
@@ -0,0 +1,18 @@
+-- This migration adds a table to quarantine rows (from the reports) that couldn't be parsed
+
+-- Table 'quarantine' stores the rows skipped by the sync because they couldn't be parsed, verbatim,
+-- along with the header of the report, so that they can be parsed (and loaded) again after fixing the parser.
+CREATE TABLE quarantine
+(
+    source         TEXT    NOT NULL, -- name of the source publishing the report, like bse/equity
+    report         TEXT    NOT NULL, -- the report (url) the row was read from
+    trading_date   TEXT    NOT NULL CHECK (trading_date IS DATE(trading_date)),
+    line           INTEGER NOT NULL, -- line number of the row in the report
+    header         TEXT    NOT NULL,
+    row            TEXT    NOT NULL,
+    error          TEXT    NOT NULL, -- reason the row couldn't be parsed (on the last attempt)
+    attempts       INTEGER NOT NULL DEFAULT 1,
+    quarantined_at TEXT    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (report, line)
+);
@@ -0,0 +1,3 @@
+-- This script rolls back v8.sql, dropping the recorded revisions
+
+DROP TABLE equity_revision;
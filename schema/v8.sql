@@ -0,0 +1,32 @@
+-- This migration adds a table to record revisions to "equity" rows (like when an exchange re-publishes a corrected report)
+
+-- Table 'equity_revision' stores the old and new values of an "equity" row each time it's revised
+-- by a sync with --on-conflict=audit. Only the values that changed are revised, but all are recorded.
+CREATE TABLE equity_revision
+(
+    exchange           TEXT NOT NULL,
+    trading_date       TEXT NOT NULL,
+    ticker             TEXT NOT NULL,
+    type               TEXT NOT NULL,
+    revised_at         TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    old_isin_code      TEXT,
+    old_open           FLOAT,
+    old_high           FLOAT,
+    old_low            FLOAT,
+    old_close          FLOAT,
+    old_last           FLOAT,
+    old_previous_close FLOAT,
+    old_volume         INTEGER,
+
+    new_isin_code      TEXT,
+    new_open           FLOAT,
+    new_high           FLOAT,
+    new_low            FLOAT,
+    new_close          FLOAT,
+    new_last           FLOAT,
+    new_previous_close FLOAT,
+    new_volume         INTEGER
+);
+
+CREATE INDEX equity_revision_row ON equity_revision (exchange, trading_date, ticker, type);
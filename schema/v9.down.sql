@@ -0,0 +1,75 @@
+-- This script rolls back v9.sql, dropping the audit trail of sync runs (and references to it)
+
+-- sqlite (3.32) can't drop columns, so "equity" and "equity_revision" are re-created without the run_id column.
+-- legacy_alter_table stops sqlite from checking the views over "equity" while the table is being re-created.
+PRAGMA legacy_alter_table = ON;
+
+DROP INDEX equity_run;
+
+CREATE TABLE equity_v8
+(
+    exchange       TEXT NOT NULL CHECK (exchange IN ('bse', 'nse')),
+    trading_date   TEXT NOT NULL CHECK (trading_date IS DATE(trading_date)),
+    ticker         TEXT NOT NULL,
+    type           TEXT NOT NULL,
+    isin_code      TEXT,
+    open           FLOAT,
+    high           FLOAT,
+    low            FLOAT,
+    close          FLOAT,
+    last           FLOAT,
+    previous_close FLOAT,
+    volume         INTEGER,
+
+    PRIMARY KEY (exchange, trading_date, ticker, type)
+) WITHOUT ROWID;
+
+INSERT INTO equity_v8
+SELECT exchange, trading_date, ticker, type, isin_code, open, high, low, close, last, previous_close, volume
+FROM equity;
+
+DROP TABLE equity;
+ALTER TABLE equity_v8 RENAME TO equity;
+CREATE INDEX equity_ticker ON equity (ticker);
+
+CREATE TABLE equity_revision_v8
+(
+    exchange           TEXT NOT NULL,
+    trading_date       TEXT NOT NULL,
+    ticker             TEXT NOT NULL,
+    type               TEXT NOT NULL,
+    revised_at         TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    old_isin_code      TEXT,
+    old_open           FLOAT,
+    old_high           FLOAT,
+    old_low            FLOAT,
+    old_close          FLOAT,
+    old_last           FLOAT,
+    old_previous_close FLOAT,
+    old_volume         INTEGER,
+
+    new_isin_code      TEXT,
+    new_open           FLOAT,
+    new_high           FLOAT,
+    new_low            FLOAT,
+    new_close          FLOAT,
+    new_last           FLOAT,
+    new_previous_close FLOAT,
+    new_volume         INTEGER
+);
+
+INSERT INTO equity_revision_v8
+SELECT exchange, trading_date, ticker, type, revised_at,
+       old_isin_code, old_open, old_high, old_low, old_close, old_last, old_previous_close, old_volume,
+       new_isin_code, new_open, new_high, new_low, new_close, new_last, new_previous_close, new_volume
+FROM equity_revision;
+
+DROP TABLE equity_revision;
+ALTER TABLE equity_revision_v8 RENAME TO equity_revision;
+CREATE INDEX equity_revision_row ON equity_revision (exchange, trading_date, ticker, type);
+
+DROP TABLE sync_run_range;
+DROP TABLE sync_run;
+
+PRAGMA legacy_alter_table = OFF;
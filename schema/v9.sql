@@ -0,0 +1,38 @@
+-- This migration adds an audit trail of sync runs, and a reference to the run on rows written by it
+
+-- Table 'sync_run' records each run of the tool that writes to "equity" table (the sync, and the
+-- gaps --repair and quarantine --retry commands), along with its outcome.
+CREATE TABLE sync_run
+(
+    id          INTEGER PRIMARY KEY,
+    command     TEXT    NOT NULL,                   -- command that started the run, like sync or gaps
+    version     TEXT    NOT NULL,                   -- version of the tool
+    arguments   TEXT    NOT NULL,                   -- command-line arguments (as a json array)
+    started_at  TEXT    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TEXT,
+    status      TEXT    NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'succeeded', 'failed')),
+    error       TEXT,
+
+    written     INTEGER NOT NULL DEFAULT 0,         -- rows inserted / updated in "equity" table
+    skipped     INTEGER NOT NULL DEFAULT 0,         -- records skipped as the rows existed (see --on-conflict)
+    revised     INTEGER NOT NULL DEFAULT 0,         -- revisions recorded in "equity_revision" table
+    failed      INTEGER NOT NULL DEFAULT 0,         -- records that couldn't be written
+    quarantined INTEGER NOT NULL DEFAULT 0          -- rows that couldn't be parsed
+);
+
+-- Table 'sync_run_range' records the range of dates synced by a run, for each exchange
+CREATE TABLE sync_run_range
+(
+    run_id    INTEGER NOT NULL REFERENCES sync_run (id),
+    exchange  TEXT    NOT NULL,
+    from_date TEXT    NOT NULL,
+    to_date   TEXT    NOT NULL,
+
+    PRIMARY KEY (run_id, exchange)
+) WITHOUT ROWID;
+
+-- the run that last wrote the row; NULL for rows written before this migration
+ALTER TABLE equity ADD COLUMN run_id INTEGER REFERENCES sync_run (id);
+ALTER TABLE equity_revision ADD COLUMN run_id INTEGER REFERENCES sync_run (id);
+
+CREATE INDEX equity_run ON equity (run_id);
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"bufio"
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"embed"
+	scsv "encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/peterh/liner"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+//go:embed queries/saved/*.sql
+var savedQueries embed.FS // named queries that can be executed from the shell using .run <name>
+
+// builtinQueries are the saved queries embedded in the binary
+var builtinQueries, _ = fs.Sub(savedQueries, "queries/saved")
+
+// output modes supported by the shell
+var outputModes = map[string]func(stmt *sqlite.Stmt, w io.Writer) error{
+	"table": printTable,
+	"csv":   printCsv,
+	"json":  printJson,
+}
+
+const shellHelp = `.help                     show this message
+.tables                   list tables and views
+.schema [name]            show schema of the named table / view (or all of them)
+.mode [table|csv|json]    show or set the output mode
+.queries                  list saved queries
+.run <name> [key=value]   run the named saved query, binding the given parameters (quote values with spaces)
+.quit                     exit the shell`
+
+// shell is an sql shell to the database
+type shell struct {
+	conn  *sqlite.Conn
+	mode  string
+	out   io.Writer
+	saved []fs.FS // directories with saved queries, in order of precedence
+}
+
+// sqlShell implements the `sql` command which provides an sql shell to the database,
+// with the technical indicator functions (see package indicators) registered on the connection.
+//
+// When stdin is a terminal, the shell is interactive with history and tab-completion;
+// otherwise (or with --execute) the statements are executed as a script.
+func sqlShell(args []string) {
+	var execute string // statements to execute
+	var queries string // directory with user's saved queries
+	var sh = &shell{out: os.Stdout}
+
+	var flags = newFlagSet("sql")
+	flags.StringVarP(&execute, "execute", "e", "", "execute the statements (or dot-commands) and exit")
+	flags.StringVar(&sh.mode, "mode", "table", "output mode (table, csv or json)")
+	flags.StringVar(&queries, "queries", "", "directory with saved queries (<name>.sql), in addition to the built-in ones")
+	_ = flags.Parse(args)
+	configureLogging()
+
+	if queries != "" { // user's queries take precedence over built-in ones with the same name
+		sh.saved = append(sh.saved, os.DirFS(queries))
+	}
+	sh.saved = append(sh.saved, builtinQueries)
+
+	if _, ok := outputModes[sh.mode]; !ok {
+		log.Fatal().Msgf("unknown output mode %q", sh.mode)
+	}
+
+	sh.conn = openDatabase(filename)
+	defer sh.conn.Close()
+
+	var err error
+	if execute != "" {
+		err = sh.script(strings.NewReader(execute))
+	} else if stat, _ := os.Stdin.Stat(); stat.Mode()&os.ModeCharDevice == 0 {
+		err = sh.script(os.Stdin)
+	} else {
+		sh.interactive()
+	}
+
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+}
+
+// script executes statements and dot-commands read from r, stopping at the first error
+func (sh *shell) script(r io.Reader) error {
+	var scanner = bufio.NewScanner(r)
+	var query strings.Builder
+	for scanner.Scan() {
+		if exit, err := sh.feed(&query, scanner.Text()); err != nil {
+			return err
+		} else if exit {
+			return nil
+		}
+	}
+
+	if strings.TrimSpace(query.String()) != "" { // last statement in a script needn't be terminated
+		return sh.execute(query.String(), nil)
+	}
+	return scanner.Err()
+}
+
+// interactive runs the shell in interactive mode, with history and tab-completion
+func (sh *shell) interactive() {
+	var line = liner.NewLiner()
+	defer line.Close()
+
+	line.SetCtrlCAborts(true)
+	line.SetWordCompleter(sh.complete)
+
+	var history = filepath.Join(os.TempDir(), ".bhav_history")
+	if home, err := os.UserHomeDir(); err == nil {
+		history = filepath.Join(home, ".bhav_history")
+	}
+
+	if f, err := os.Open(history); err == nil {
+		_, _ = line.ReadHistory(f)
+		_ = f.Close()
+	}
+
+	_, _ = fmt.Fprintln(sh.out, `enter ".help" for usage hints`)
+
+	var query strings.Builder
+	for {
+		var prompt = "bhav> "
+		if query.Len() > 0 {
+			prompt = "   ...> "
+		}
+
+		var input, err = line.Prompt(prompt)
+		if err == liner.ErrPromptAborted { // ctrl+c discards the current statement
+			query.Reset()
+			continue
+		} else if err != nil { // ctrl+d (or error reading input) exits the shell
+			break
+		}
+
+		if query.Len() == 0 && strings.TrimSpace(input) == "" {
+			continue
+		}
+		line.AppendHistory(input)
+
+		var exit bool
+		if exit, err = sh.feed(&query, input); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+		if exit {
+			break
+		}
+	}
+
+	if f, err := os.Create(history); err == nil {
+		_, _ = line.WriteHistory(f)
+		_ = f.Close()
+	}
+}
+
+// feed adds a line of input to the statement being built in query, executing the statement once it's complete
+// (terminated with a semicolon). Dot-commands are executed immediately. It returns true if the shell must exit.
+func (sh *shell) feed(query *strings.Builder, input string) (exit bool, err error) {
+	if query.Len() == 0 && strings.HasPrefix(strings.TrimSpace(input), ".") {
+		var args, err = splitArgs(input)
+		if err != nil {
+			return false, err
+		}
+		return sh.command(args)
+	}
+
+	query.WriteString(input)
+	query.WriteString("\n")
+	if !strings.HasSuffix(strings.TrimSpace(query.String()), ";") {
+		return false, nil
+	}
+
+	defer query.Reset()
+	return false, sh.execute(query.String(), nil)
+}
+
+// command executes a dot-command
+func (sh *shell) command(args []string) (exit bool, err error) {
+	switch args[0] {
+	case ".help":
+		_, _ = fmt.Fprintln(sh.out, shellHelp)
+
+	case ".quit", ".exit":
+		return true, nil
+
+	case ".tables":
+		var names, _ = sh.names()
+		_, _ = fmt.Fprintln(sh.out, strings.Join(names, "\n"))
+
+	case ".schema":
+		var query = "SELECT sql FROM sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'"
+		if len(args) > 1 {
+			query += fmt.Sprintf(" AND tbl_name = '%s'", strings.ReplaceAll(args[1], "'", "''"))
+		}
+		err = sqlitex.Exec(sh.conn, query, func(stmt *sqlite.Stmt) error {
+			_, _ = fmt.Fprintf(sh.out, "%s;\n", stmt.GetText("sql"))
+			return nil
+		})
+
+	case ".mode":
+		if len(args) == 1 {
+			_, _ = fmt.Fprintln(sh.out, sh.mode)
+		} else if _, ok := outputModes[args[1]]; !ok {
+			return false, errors.Errorf("unknown output mode %q", args[1])
+		} else {
+			sh.mode = args[1]
+		}
+
+	case ".queries":
+		var tw = tabwriter.NewWriter(sh.out, 0, 4, 2, ' ', 0)
+		for _, name := range sh.savedQueryNames() {
+			var query, _ = sh.savedQuery(name)
+			var description = strings.SplitN(string(query), "\n", 2)[0]
+			_, _ = fmt.Fprintf(tw, "%s\t%s\n", name, strings.TrimSpace(strings.TrimPrefix(description, "--")))
+		}
+		_ = tw.Flush()
+
+	case ".run":
+		if len(args) < 2 {
+			return false, errors.New("usage: .run <name> [key=value ...]")
+		}
+
+		var query string
+		if query, err = sh.savedQuery(args[1]); err != nil {
+			return false, err
+		}
+
+		var params = make(map[string]string)
+		for _, arg := range args[2:] {
+			var kv = strings.SplitN(arg, "=", 2)
+			if len(kv) != 2 {
+				return false, errors.Errorf("invalid parameter %q; must be key=value", arg)
+			}
+			params[kv[0]] = kv[1]
+		}
+		err = sh.execute(query, params)
+
+	default:
+		err = errors.Errorf("unknown command %q; enter \".help\" for usage hints", args[0])
+	}
+
+	return false, err
+}
+
+// execute executes all statements in the query, binding the given named parameters, and prints the results
+func (sh *shell) execute(query string, params map[string]string) (err error) {
+	for query = strings.TrimSpace(query); query != ""; query = strings.TrimSpace(query) {
+		var stmt *sqlite.Stmt
+		var trailing int
+		if stmt, trailing, err = sh.conn.PrepareTransient(query); err != nil {
+			return err
+		}
+
+		var text = query[:len(query)-trailing]
+		query = query[len(query)-trailing:]
+		if stmt == nil { // statement was only a comment
+			continue
+		}
+
+		if params != nil && stmt.BindParamCount() > 0 { // only saved queries take parameters
+			var names map[int]string
+			if names, err = paramNames(sh.conn, text); err != nil {
+				_ = stmt.Finalize()
+				return err
+			}
+
+			for i := 1; i <= stmt.BindParamCount(); i++ {
+				if value, ok := params[names[i]]; !ok {
+					_ = stmt.Finalize()
+					return errors.Errorf("missing value for parameter %q", names[i])
+				} else {
+					stmt.BindText(i, value)
+				}
+			}
+		}
+
+		err = outputModes[sh.mode](stmt, sh.out)
+		_ = stmt.Finalize()
+		if err != nil {
+			return errors.Wrapf(err, "failed to execute query")
+		}
+	}
+	return nil
+}
+
+// names returns names of all tables and views in the database
+func (sh *shell) names() (names []string, err error) {
+	const query = "SELECT name FROM sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' ORDER BY name"
+	err = sqlitex.Exec(sh.conn, query, func(stmt *sqlite.Stmt) error {
+		names = append(names, stmt.GetText("name"))
+		return nil
+	})
+	return names, err
+}
+
+// complete provides tab-completion for dot-commands, saved queries, tables and their columns
+func (sh *shell) complete(line string, pos int) (head string, completions []string, tail string) {
+	var start = strings.LastIndexAny(line[:pos], " \t\n(,") + 1
+	head, tail = line[:start], line[pos:]
+	var word = strings.ToLower(line[start:pos])
+
+	var candidates []string
+	if strings.TrimSpace(head) == "" {
+		candidates = []string{".help", ".tables", ".schema", ".mode", ".queries", ".run", ".quit"}
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(head), ".run") {
+		candidates = append(candidates, sh.savedQueryNames()...)
+	} else {
+		var tables, _ = sh.names()
+		candidates = append(candidates, tables...)
+		for _, table := range tables {
+			_ = sqlitex.Exec(sh.conn, fmt.Sprintf("PRAGMA table_info('%s')", table), func(stmt *sqlite.Stmt) error {
+				candidates = append(candidates, stmt.GetText("name"))
+				return nil
+			})
+		}
+	}
+
+	var seen = make(map[string]bool)
+	for _, candidate := range candidates {
+		if !seen[candidate] && strings.HasPrefix(strings.ToLower(candidate), word) {
+			seen[candidate], completions = true, append(completions, candidate)
+		}
+	}
+	sort.Strings(completions)
+	return head, completions, tail
+}
+
+// savedQueryNames returns names of all saved queries, in order
+func (sh *shell) savedQueryNames() (names []string) {
+	var seen = make(map[string]bool)
+	for _, dir := range sh.saved {
+		var entries, _ = fs.Glob(dir, "*.sql")
+		for _, entry := range entries {
+			if name := strings.TrimSuffix(entry, ".sql"); !seen[name] {
+				seen[name], names = true, append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// savedQuery returns the saved query with the given name, from the first directory that has it
+func (sh *shell) savedQuery(name string) (string, error) {
+	if !fs.ValidPath(name) || strings.Contains(name, "/") {
+		return "", errors.Errorf("invalid query name %q", name)
+	}
+
+	for _, dir := range sh.saved {
+		if query, err := fs.ReadFile(dir, name+".sql"); err == nil {
+			return string(query), nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", errors.Wrapf(err, "failed to read saved query %q", name)
+		}
+	}
+	return "", errors.Errorf("no saved query named %q", name)
+}
+
+// splitArgs splits a dot-command into arguments separated by whitespace. Single or double quotes
+// (anywhere in an argument) group characters, including whitespace, into the argument, as in key='a b'.
+func splitArgs(input string) (args []string, err error) {
+	var arg strings.Builder
+	var quote rune    // quote character of the quoted section being read, if any
+	var inArg = false // whether an argument is being read (it may be empty, as in '')
+	for _, r := range input {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args, inArg = append(args, arg.String()), false
+				arg.Reset()
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.Errorf("unterminated quote %c", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// columns returns names of the columns in the result set of stmt
+func columns(stmt *sqlite.Stmt) []string {
+	var names = make([]string, stmt.ColumnCount())
+	for i := range names {
+		names[i] = stmt.ColumnName(i)
+	}
+	return names
+}
+
+// value returns the value of the column in the current row, as a go value
+func value(stmt *sqlite.Stmt, col int) interface{} {
+	switch stmt.ColumnType(col) {
+	case sqlite.SQLITE_NULL:
+		return nil
+	case sqlite.SQLITE_INTEGER:
+		return stmt.ColumnInt64(col)
+	case sqlite.SQLITE_FLOAT:
+		return stmt.ColumnFloat(col)
+	default:
+		return stmt.ColumnText(col)
+	}
+}
+
+// printTable prints the result set of stmt as an aligned table
+func printTable(stmt *sqlite.Stmt, w io.Writer) error {
+	var tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	defer tw.Flush()
+
+	var names = columns(stmt)
+	if len(names) > 0 {
+		_, _ = fmt.Fprintln(tw, strings.Join(names, "\t"))
+	}
+
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return err
+		} else if !hasRow {
+			return nil
+		}
+
+		var values = make([]string, len(names))
+		for i := range values {
+			values[i] = stmt.ColumnText(i)
+		}
+		_, _ = fmt.Fprintln(tw, strings.Join(values, "\t"))
+	}
+}
+
+// printCsv prints the result set of stmt as csv, with a header row
+func printCsv(stmt *sqlite.Stmt, w io.Writer) error {
+	var cw = scsv.NewWriter(w)
+	defer cw.Flush()
+
+	var names = columns(stmt)
+	if len(names) > 0 {
+		_ = cw.Write(names)
+	}
+
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return err
+		} else if !hasRow {
+			return nil
+		}
+
+		var values = make([]string, len(names))
+		for i := range values {
+			values[i] = stmt.ColumnText(i)
+		}
+		_ = cw.Write(values)
+	}
+}
+
+// printJson prints the result set of stmt as a json array of objects (one per row)
+func printJson(stmt *sqlite.Stmt, w io.Writer) error {
+	var names = columns(stmt)
+	if len(names) == 0 { // not a query; nothing to print
+		_, err := stmt.Step()
+		return err
+	}
+
+	_, _ = fmt.Fprint(w, "[")
+	for n := 0; ; n++ {
+		if hasRow, err := stmt.Step(); err != nil {
+			return err
+		} else if !hasRow && n == 0 {
+			_, _ = fmt.Fprintln(w, "]")
+			return nil
+		} else if !hasRow {
+			_, _ = fmt.Fprintln(w, "\n]")
+			return nil
+		}
+
+		if n > 0 {
+			_, _ = fmt.Fprint(w, ",")
+		}
+
+		var fields = make([]string, len(names))
+		for i := range names {
+			var k, _ = json.Marshal(names[i])
+			var v, err = json.Marshal(value(stmt, i))
+			if err != nil {
+				return errors.Wrapf(err, "failed to encode column %q", names[i])
+			}
+			fields[i] = string(k) + ":" + string(v)
+		}
+		_, _ = fmt.Fprintf(w, "\n  {%s}", strings.Join(fields, ","))
+	}
+}
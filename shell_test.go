@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	var tests = []struct {
+		input string
+		args  []string
+	}{
+		{input: ".run history exchange=nse ticker=INFY", args: []string{".run", "history", "exchange=nse", "ticker=INFY"}},
+		{input: "  .mode\tcsv  ", args: []string{".mode", "csv"}},
+		{input: `.run search name='tata motors' type="E Q"`, args: []string{".run", "search", "name=tata motors", "type=E Q"}},
+		{input: `.run search name="it's" note='say "hi"'`, args: []string{".run", "search", "name=it's", `note=say "hi"`}},
+		{input: ".run search name='' 'a b'c", args: []string{".run", "search", "name=", "a bc"}},
+	}
+
+	for _, test := range tests {
+		var args, err = splitArgs(test.input)
+		if err != nil {
+			t.Errorf("splitArgs(%q) failed: %v", test.input, err)
+		} else if fmt.Sprintf("%q", args) != fmt.Sprintf("%q", test.args) {
+			t.Errorf("splitArgs(%q) = %q; want %q", test.input, args, test.args)
+		}
+	}
+
+	if _, err := splitArgs(".run search name='tata"); err == nil {
+		t.Errorf("expected unterminated quote to fail")
+	}
+}
+
+func TestShell(t *testing.T) {
+	var dir = t.TempDir()
+	var queries = filepath.Join(dir, "queries")
+	if err := os.Mkdir(queries, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var write = func(name, query string) {
+		if err := os.WriteFile(filepath.Join(queries, name), []byte(query), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("echo.sql", "-- echoes the parameter (params: value)\nSELECT :value AS value")
+	write("literal.sql", "-- ignores :bar in comments (params: value)\nSELECT ':foo' AS a, :value AS b -- and :baz here")
+	write("day.sql", "-- overrides the built-in query\nSELECT 'mine' AS day")
+
+	var out bytes.Buffer
+	var sh = &shell{conn: openDatabase(filepath.Join(dir, "bhavcopy.db")), mode: "csv", out: &out,
+		saved: []fs.FS{os.DirFS(queries), builtinQueries}}
+	defer sh.conn.Close()
+
+	var tests = []struct {
+		script, output string
+	}{
+		{script: "SELECT 1 AS a,\n 'x' AS b;", output: "a,b\n1,x\n"},
+		{script: ".run echo value='a b'", output: "value\na b\n"},
+		{script: ".run literal value=1", output: "a,b\n:foo,1\n"},
+		{script: ".run day", output: "day\nmine\n"},
+		{script: ".mode json\n.run echo value=\"it's\"", output: "[\n  {\"value\":\"it's\"}\n]\n"},
+	}
+
+	for _, test := range tests {
+		out.Reset()
+		sh.mode = "csv"
+		if err := sh.script(strings.NewReader(test.script)); err != nil {
+			t.Errorf("%q failed: %v", test.script, err)
+		} else if out.String() != test.output {
+			t.Errorf("%q printed %q; want %q", test.script, out.String(), test.output)
+		}
+	}
+
+	out.Reset()
+	if err := sh.script(strings.NewReader(".queries")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"echo  ", "echoes the parameter", "history  ", "overrides the built-in query"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected .queries to list %q; got %q", want, out.String())
+		}
+	}
+
+	for _, invalid := range []string{".run missing", ".run echo", ".run ../echo", ".run echo value='a b", ".mode json\nSELECT 1e308 * 10 AS inf"} {
+		if err := sh.script(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected %q to fail", invalid)
+		}
+	}
+}
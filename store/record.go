@@ -0,0 +1,62 @@
+package store
+
+import (
+	"crawshaw.io/sqlite"
+	"time"
+)
+
+// Record is a row of "equity" table. It implements pipeline.Equity.
+type Record struct {
+	Market        string
+	Date          time.Time
+	Symbol        string // ticker as recorded on the trading date
+	CurrentSymbol string // current ticker of the security (after any symbol changes)
+	Series        string
+	Isin          string
+	Ohlc          struct {
+		Open, High, Low, Close float64
+	}
+	LastValue      float64
+	PrevCloseValue float64
+	TotalQuantity  int64 // zero for records synced before volume was recorded
+}
+
+func (r *Record) Exchange() string       { return r.Market }
+func (r *Record) TradingDate() time.Time { return r.Date }
+func (r *Record) Ticker() string         { return r.Symbol }
+func (r *Record) Type() string           { return r.Series }
+func (r *Record) ISIN() string           { return r.Isin }
+func (r *Record) Last() float64          { return r.LastValue }
+func (r *Record) PrevClose() float64     { return r.PrevCloseValue }
+func (r *Record) Volume() int64          { return r.TotalQuantity }
+func (r *Record) OHLC() (open, high, low, close float64) {
+	return r.Ohlc.Open, r.Ohlc.High, r.Ohlc.Low, r.Ohlc.Close
+}
+
+// scanRecord reads a record from a row of "equity_history" view
+func scanRecord(stmt *sqlite.Stmt) *Record {
+	var record = &Record{
+		Market:         stmt.GetText("exchange"),
+		Symbol:         stmt.GetText("ticker"),
+		CurrentSymbol:  stmt.GetText("current_ticker"),
+		Series:         stmt.GetText("type"),
+		Isin:           stmt.GetText("isin_code"),
+		LastValue:      stmt.GetFloat("last"),
+		PrevCloseValue: stmt.GetFloat("previous_close"),
+		TotalQuantity:  stmt.GetInt64("volume"),
+	}
+	record.Date, _ = time.Parse("2006-01-02", stmt.GetText("trading_date"))
+	record.Ohlc.Open, record.Ohlc.High = stmt.GetFloat("open"), stmt.GetFloat("high")
+	record.Ohlc.Low, record.Ohlc.Close = stmt.GetFloat("low"), stmt.GetFloat("close")
+	return record
+}
+
+// Instrument is a security traded on an exchange, identified by its current ticker
+type Instrument struct {
+	Market    string
+	Symbol    string // current ticker of the security
+	Series    string
+	Isin      string    // isin code on the last trading date; empty if not known
+	FirstDate time.Time // first trading date recorded
+	LastDate  time.Time // last trading date recorded
+}
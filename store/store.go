@@ -0,0 +1,139 @@
+// Package store provides typed access to a database synced by bhav, for programs that read the data
+// (like services) without writing sql. Opening a database applies the pending schema migrations (see package schema),
+// so the database is guaranteed to have the same schema as the one used by the tool.
+package store
+
+import (
+	"context"
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"github.com/pkg/errors"
+	"go.riyazali.net/bhav/queries"
+	"go.riyazali.net/bhav/schema"
+	"time"
+)
+
+// DefaultPoolSize is the number of connections opened to the database, unless configured otherwise
+const DefaultPoolSize = 4
+
+// Store is a pool of connections to a database synced by bhav. It's safe for concurrent use.
+type Store struct {
+	pool *sqlitex.Pool
+}
+
+// Open opens the named database file with a pool of poolSize connections (DefaultPoolSize if not positive),
+// creating the file if it doesn't exist and applying the pending schema migrations.
+func Open(name string, poolSize int) (_ *Store, err error) {
+	if poolSize <= 0 {
+		poolSize = DefaultPoolSize
+	}
+
+	const flags = sqlite.SQLITE_OPEN_CREATE | sqlite.SQLITE_OPEN_READWRITE | sqlite.SQLITE_OPEN_URI | sqlite.SQLITE_OPEN_NOMUTEX
+	var pool *sqlitex.Pool
+	if pool, err = sqlitex.Open(name, flags, poolSize); err != nil {
+		return nil, errors.Wrapf(err, "failed to open database %s", name)
+	}
+
+	var conn = pool.Get(context.Background())
+	err = schema.Apply(conn)
+	pool.Put(conn)
+	if err != nil {
+		_ = pool.Close()
+		return nil, errors.Wrap(err, "failed to apply migration")
+	}
+
+	return &Store{pool: pool}, nil
+}
+
+// Close closes all the connections to the database
+func (s *Store) Close() error { return s.pool.Close() }
+
+// query executes the query with named parameters (bound using bind) on a connection from the pool, calling fn for
+// each row of the result. The query is interrupted if the context is cancelled.
+func (s *Store) query(ctx context.Context, query string, bind func(stmt *sqlite.Stmt), fn func(stmt *sqlite.Stmt) error) (err error) {
+	var conn = s.pool.Get(ctx)
+	if conn == nil {
+		if err = ctx.Err(); err == nil {
+			err = errors.New("store is closed")
+		}
+		return err
+	}
+	defer s.pool.Put(conn)
+
+	var stmt *sqlite.Stmt
+	if stmt, err = conn.Prepare(query); err != nil {
+		return err
+	}
+	defer stmt.Reset()
+
+	bind(stmt)
+	for {
+		var hasRow bool
+		if hasRow, err = stmt.Step(); err != nil {
+			return err
+		} else if !hasRow {
+			return nil
+		}
+
+		if err = fn(stmt); err != nil {
+			return err
+		}
+	}
+}
+
+// History returns the records of the ticker on the exchange between from and to (inclusive), ordered by trading date.
+// The ticker is matched against the current ticker of the records, so the history spans any symbol changes.
+func (s *Store) History(ctx context.Context, ticker, exchange string, from, to time.Time) (_ []*Record, err error) {
+	var records []*Record
+	err = s.query(ctx, queries.SelectEquityHistory, func(stmt *sqlite.Stmt) {
+		stmt.SetText(":exchange", exchange)
+		stmt.SetText(":ticker", ticker)
+		stmt.SetText(":from", from.Format("2006-01-02"))
+		stmt.SetText(":to", to.Format("2006-01-02"))
+	}, func(stmt *sqlite.Stmt) error {
+		records = append(records, scanRecord(stmt))
+		return nil
+	})
+	return records, errors.Wrapf(err, "failed to fetch history of %s/%s", exchange, ticker)
+}
+
+// Day returns all the records of the exchange on the trading date, ordered by ticker.
+// It returns no record if the date isn't a trading day (or hasn't been synced yet).
+func (s *Store) Day(ctx context.Context, exchange string, date time.Time) (_ []*Record, err error) {
+	var records []*Record
+	err = s.query(ctx, queries.SelectEquityDay, func(stmt *sqlite.Stmt) {
+		stmt.SetText(":exchange", exchange)
+		stmt.SetText(":trading_date", date.Format("2006-01-02"))
+	}, func(stmt *sqlite.Stmt) error {
+		records = append(records, scanRecord(stmt))
+		return nil
+	})
+	return records, errors.Wrapf(err, "failed to fetch records of %s on %s", exchange, date.Format("2006-01-02"))
+}
+
+// Instruments returns the instruments recorded in the database (by their current ticker), ordered by exchange and ticker
+func (s *Store) Instruments(ctx context.Context) (_ []*Instrument, err error) {
+	var instruments []*Instrument
+	err = s.query(ctx, queries.SelectInstruments, func(*sqlite.Stmt) {}, func(stmt *sqlite.Stmt) error {
+		var first, _ = time.Parse("2006-01-02", stmt.GetText("first_date"))
+		var last, _ = time.Parse("2006-01-02", stmt.GetText("last_date"))
+		instruments = append(instruments, &Instrument{
+			Market: stmt.GetText("exchange"), Symbol: stmt.GetText("ticker"), Series: stmt.GetText("type"),
+			Isin: stmt.GetText("isin_code"), FirstDate: first, LastDate: last,
+		})
+		return nil
+	})
+	return instruments, errors.Wrap(err, "failed to fetch instruments")
+}
+
+// LatestDate returns the last trading date recorded for the exchange.
+// It returns zero time if nothing is recorded for the exchange.
+func (s *Store) LatestDate(ctx context.Context, exchange string) (last time.Time, err error) {
+	err = s.query(ctx, queries.LastTradingDateByExchange, func(stmt *sqlite.Stmt) {
+		stmt.SetText(":exchange", exchange)
+	}, func(stmt *sqlite.Stmt) error {
+		last, _ = time.Parse("2006-01-02", stmt.GetText("last_trading_date"))
+		return nil
+	})
+	return last, errors.Wrapf(err, "failed to fetch last trading date of %s", exchange)
+}
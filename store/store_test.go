@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"fmt"
+	"go.riyazali.net/bhav/pipeline"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var _ pipeline.Equity = (*Record)(nil)
+
+// open opens a store on a temporary database, with the given statements executed on it
+func open(t *testing.T, script string) *Store {
+	t.Helper()
+	var name = filepath.Join(t.TempDir(), "bhavcopy.db")
+
+	var store, err = Open(name, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	var conn *sqlite.Conn
+	if conn, err = sqlite.OpenConn(name, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err = sqlitex.ExecScript(conn, script); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func date(s string) time.Time { var d, _ = time.Parse("2006-01-02", s); return d }
+
+const data = `
+INSERT INTO equity (exchange, trading_date, ticker, type, isin_code, open, high, low, close, last, previous_close, volume)
+VALUES ('nse', '2021-03-01', 'INFY', 'EQ', 'INE009A01021', 1300, 1320, 1290, 1305, 1306, 1299, 100),
+       ('nse', '2021-03-02', 'INFY', 'EQ', 'INE009A01021', 1305, 1330, 1300, 1325, 1326, 1305, 200),
+       ('nse', '2021-03-01', 'OLDTCS', 'EQ', 'INE467B01029', 3000, 3010, 2990, 3005, 3005, 2995, 50),
+       ('nse', '2021-03-02', 'TCS', 'EQ', 'INE467B01029', 3005, 3020, 3000, 3015, 3015, 3005, 60),
+       ('bse', '2021-03-01', '500209', 'A', 'INE009A01021', 1301, 1321, 1291, 1306, 1306, 1300, 10);
+INSERT INTO symbol_change (exchange, old_symbol, new_symbol, effective_date, source)
+VALUES ('nse', 'OLDTCS', 'TCS', '2021-03-02', 'exchange');
+`
+
+func TestStore(t *testing.T) {
+	var ctx = context.Background()
+	var store = open(t, data)
+
+	var history, err = store.History(ctx, "TCS", "nse", date("2021-03-01"), date("2021-03-31"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Ticker() != "OLDTCS" || history[1].Ticker() != "TCS" || history[0].CurrentSymbol != "TCS" {
+		t.Errorf("expected history of TCS to span the symbol change; got %+v", history)
+	}
+
+	if history, _ = store.History(ctx, "INFY", "nse", date("2021-03-02"), date("2021-03-02")); len(history) != 1 {
+		t.Fatalf("expected a single record on 2021-03-02; got %d", len(history))
+	}
+	var infy pipeline.Equity = history[0]
+	if open, high, low, close := infy.OHLC(); open != 1305 || high != 1330 || low != 1300 || close != 1325 {
+		t.Errorf("unexpected ohlc %v %v %v %v", open, high, low, close)
+	}
+	if !infy.TradingDate().Equal(date("2021-03-02")) || infy.Volume() != 200 || infy.Last() != 1326 || infy.PrevClose() != 1305 ||
+		infy.ISIN() != "INE009A01021" || infy.Type() != "EQ" || infy.Exchange() != "nse" {
+		t.Errorf("unexpected record %+v", infy)
+	}
+
+	var day []*Record
+	if day, err = store.Day(ctx, "nse", date("2021-03-01")); err != nil {
+		t.Fatal(err)
+	}
+	if len(day) != 2 || day[0].Ticker() != "INFY" || day[1].Ticker() != "OLDTCS" {
+		t.Errorf("unexpected records on 2021-03-01: %+v", day)
+	}
+
+	var instruments []*Instrument
+	if instruments, err = store.Instruments(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(instruments) != 3 {
+		t.Fatalf("expected 3 instruments; got %+v", instruments)
+	}
+	if tcs := instruments[2]; tcs.Symbol != "TCS" || !tcs.FirstDate.Equal(date("2021-03-01")) ||
+		!tcs.LastDate.Equal(date("2021-03-02")) || tcs.Isin != "INE467B01029" {
+		t.Errorf("unexpected instrument %+v", tcs)
+	}
+
+	var latest time.Time
+	if latest, err = store.LatestDate(ctx, "bse"); err != nil || !latest.Equal(date("2021-03-01")) {
+		t.Errorf("expected latest date of bse to be 2021-03-01; got %s (%v)", latest, err)
+	}
+	if latest, _ = store.LatestDate(ctx, "mcx"); !latest.IsZero() {
+		t.Errorf("expected zero latest date for an exchange with no records; got %s", latest)
+	}
+}
+
+// a ticker renamed, and later reused by another security (that's renamed too), must resolve to a single current ticker
+func TestReusedTicker(t *testing.T) {
+	var ctx = context.Background()
+	var store = open(t, `
+INSERT INTO equity (exchange, trading_date, ticker, type, close)
+VALUES ('nse', '2021-03-01', 'ABC', 'EQ', 10),
+       ('nse', '2021-03-02', 'ABCL', 'EQ', 11),
+       ('nse', '2021-03-03', 'ABC', 'EQ', 20),
+       ('nse', '2021-03-04', 'XYZ', 'EQ', 21),
+       ('nse', '2021-03-05', 'ABC', 'EQ', 30);
+INSERT INTO symbol_change (exchange, old_symbol, new_symbol, effective_date, source)
+VALUES ('nse', 'ABC', 'ABCL', '2021-03-02', 'exchange'),
+       ('nse', 'ABC', 'XYZ', '2021-03-04', 'exchange');
+`)
+
+	var tests = []struct {
+		ticker string
+		dates  []string // expected trading dates in the history of the ticker
+	}{
+		{ticker: "ABCL", dates: []string{"2021-03-01", "2021-03-02"}},
+		{ticker: "XYZ", dates: []string{"2021-03-03", "2021-03-04"}},
+		{ticker: "ABC", dates: []string{"2021-03-05"}}, // traded after the last rename, resolves to itself
+	}
+
+	for _, test := range tests {
+		var history, err = store.History(ctx, test.ticker, "nse", date("2021-03-01"), date("2021-03-31"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var dates []string
+		for _, record := range history {
+			dates = append(dates, record.TradingDate().Format("2006-01-02"))
+		}
+		if fmt.Sprint(dates) != fmt.Sprint(test.dates) {
+			t.Errorf("expected history of %s on %v; got %v", test.ticker, test.dates, dates)
+		}
+	}
+
+	if day, _ := store.Day(ctx, "nse", date("2021-03-01")); len(day) != 1 || day[0].CurrentSymbol != "ABCL" {
+		t.Errorf("expected a single record on 2021-03-01 resolving to ABCL; got %+v", day)
+	}
+}
+
+func TestCancelled(t *testing.T) {
+	var store = open(t, data)
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := store.Day(ctx, "nse", date("2021-03-01")); err == nil {
+		t.Errorf("expected error with a cancelled context")
+	}
+}
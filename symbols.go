@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	_ "embed"
+	"github.com/pkg/errors"
+	"go.riyazali.net/bhav/pipeline"
+	"os"
+)
+
+//go:embed queries/insert_symbol_change.sql
+var insertSymbolChange string // query to insert data into "symbol_change" table
+
+//go:embed queries/infer_symbol_changes.sql
+var inferSymbolChanges string // query to infer symbol changes from "equity" table
+
+// readNseSymbolChanges reads nse's symbol changes from the given file,
+// or downloads it from the exchange if name is "download"
+func readNseSymbolChanges(name string) (_ []pipeline.SymbolChange, err error) {
+	if name == "download" {
+		return pipeline.FetchNseSymbolChanges()
+	}
+
+	var file *os.File
+	if file, err = os.Open(name); err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", name)
+	}
+	defer file.Close()
+
+	return pipeline.ReadNseSymbolChanges(file)
+}
+
+// importSymbolChanges records symbol changes published by the exchange in the "symbol_change" table
+func importSymbolChanges(c *sqlite.Conn, changes []pipeline.SymbolChange) (n int, err error) {
+	var ins = c.Prep(insertSymbolChange)
+	for _, change := range changes {
+		ins.SetText(":exchange", change.Exchange)
+		ins.SetText(":old_symbol", change.OldSymbol)
+		ins.SetText(":new_symbol", change.NewSymbol)
+		ins.SetText(":effective_date", change.Date.Format("2006-01-02"))
+		ins.SetText(":source", "exchange")
+		if _, err = ins.Step(); err != nil {
+			return n, errors.Wrapf(err, "failed to import symbol change %s -> %s", change.OldSymbol, change.NewSymbol)
+		}
+		n += c.Changes()
+		_ = ins.Reset()
+	}
+	return n, nil
+}
+
+// inferTickerChanges infers symbol changes from continuity of isin_code in "equity" table
+func inferTickerChanges(c *sqlite.Conn) (n int, err error) {
+	if err = sqlitex.Exec(c, inferSymbolChanges, nil); err != nil {
+		return 0, errors.Wrapf(err, "failed to infer symbol changes")
+	}
+	return c.Changes(), nil
+}
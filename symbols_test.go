@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestInferTickerChanges(t *testing.T) {
+	var conn = openDatabase(filepath.Join(t.TempDir(), "bhavcopy.db"))
+	defer conn.Close()
+
+	// INE001 is renamed ABC -> XYZ, and ABC is later reused by INE002;
+	// INE003 is renamed twice (P -> Q -> R), and INE004 (without a rename) must not be linked to any
+	const rows = `INSERT INTO equity (exchange, trading_date, ticker, type, isin_code, close)
+		VALUES ('nse', '2021-01-04', 'ABC', 'EQ', 'INE001', 10),
+		       ('nse', '2021-01-05', 'ABC', 'EQ', 'INE001', 11),
+		       ('nse', '2021-02-01', 'XYZ', 'EQ', 'INE001', 12),
+		       ('nse', '2021-03-01', 'ABC', 'EQ', 'INE002', 50),
+		       ('nse', '2021-03-02', 'ABC', 'EQ', 'INE002', 51),
+		       ('nse', '2021-01-04', 'P', 'EQ', 'INE003', 1),
+		       ('nse', '2021-02-01', 'Q', 'EQ', 'INE003', 2),
+		       ('nse', '2021-03-01', 'R', 'EQ', 'INE003', 3),
+		       ('nse', '2021-01-04', 'S', 'EQ', 'INE004', 5),
+		       ('bse', '2021-01-04', '500001', 'A', '', 7),
+		       ('bse', '2021-02-01', '500002', 'A', '', 8)`
+	if err := sqlitex.ExecScript(conn, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	var n, err = inferTickerChanges(conn)
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 3 {
+		t.Errorf("inferTickerChanges() = %d; want 3", n)
+	}
+
+	var changes []string
+	var fn = func(stmt *sqlite.Stmt) error {
+		changes = append(changes, stmt.ColumnText(0))
+		return nil
+	}
+	const query = `SELECT old_symbol || ' -> ' || new_symbol || ' ' || effective_date || ' ' || source
+		FROM symbol_change ORDER BY old_symbol`
+	if err = sqlitex.Exec(conn, query, fn); err != nil {
+		t.Fatal(err)
+	}
+	var want = []string{"ABC -> XYZ 2021-02-01 isin", "P -> Q 2021-02-01 isin", "Q -> R 2021-03-01 isin"}
+	if len(changes) != len(want) {
+		t.Fatalf("got symbol changes %q; want %q", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("got symbol changes %q; want %q", changes, want)
+			break
+		}
+	}
+
+	// running it again doesn't record the changes twice
+	if n, err = inferTickerChanges(conn); err != nil || n != 0 {
+		t.Errorf("inferTickerChanges() = %d, %v on second run; want 0", n, err)
+	}
+
+	// history of the current ticker spans its renames, but not the rows of another security reusing an old ticker
+	var tests = map[string]int{"XYZ": 3, "R": 3, "ABC": 2, "S": 1}
+	for ticker, want := range tests {
+		const q = "SELECT COUNT(*) FROM equity_history WHERE exchange = 'nse' AND current_ticker = '%s'"
+		if got := count(t, conn, fmt.Sprintf(q, ticker)); got != want {
+			t.Errorf("got %d rows in history of %s; want %d", got, ticker, want)
+		}
+	}
+}
@@ -2,11 +2,19 @@ package main
 
 import (
 	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
 	"github.com/rs/zerolog/log"
+	"go.riyazali.net/bhav/indicators"
+	"go.riyazali.net/bhav/pipeline"
+	"go.riyazali.net/bhav/queries"
+	"go.riyazali.net/bhav/schema"
 	"math"
+	"strings"
 	"time"
 )
 
+var day = time.Hour * 24
+
 // date implements pflag.Value to parse timestamp from command-line
 type date time.Time
 
@@ -14,25 +22,69 @@ func (d *date) String() string     { return time.Time(*d).Format("02-Jan-2006")
 func (d *date) Type() string       { return "timestamp" }
 func (d *date) Set(s string) error { tt, err := time.Parse("02-Jan-2006", s); *d = date(tt); return err }
 
-// returns last sync date from database
-func minDatabaseDate(c *sqlite.Conn) (bse, nse time.Time) {
-	var stmt = c.Prep(lastTradingDate)
-	defer stmt.Finalize()
-
-	for exchange, ts := range map[string]*time.Time{"bse": &bse, "nse": &nse} {
-		stmt.SetText(":exchange", exchange)
-		if r, err := stmt.Step(); err != nil {
-			log.Fatal().Err(err).Msg("failed to fetch sync information from database")
-		} else if !r {
-			// possible that we don't find any data for the given exchange ..
-			// because maybe we are syncing for the first time for the given exchange
-			_ = stmt.Reset()
-			continue
+// openDatabase opens a connection to the given database file and applies all pending schema migrations
+func openDatabase(name string) *sqlite.Conn {
+	log.Info().Str("file", name).Msg("opening database file")
+	const flags = sqlite.SQLITE_OPEN_CREATE | sqlite.SQLITE_OPEN_READWRITE
+	var conn, err = sqlite.OpenConn(name, flags)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open database file")
+	}
+
+	log.Info().Msgf("applying schema migration to %s", name)
+	if err = schema.Apply(conn); err != nil {
+		log.Fatal().Err(err).Msg("failed to apply migration")
+	}
+
+	if err = indicators.Register(conn); err != nil {
+		log.Fatal().Err(err).Msg("failed to register sql functions")
+	}
+
+	return conn
+}
+
+// paramNames returns the names (without the :, @ or $ prefix) of the parameters in the query, by their index.
+// crawshaw.io/sqlite doesn't expose sqlite3_bind_parameter_name, so the names are read from the Variable opcodes
+// of the program sqlite compiles the query into; text in string literals and comments is never mistaken for a parameter.
+func paramNames(c *sqlite.Conn, query string) (names map[int]string, err error) {
+	names = make(map[int]string)
+	err = sqlitex.ExecTransient(c, "EXPLAIN "+query, func(stmt *sqlite.Stmt) error {
+		if stmt.GetText("opcode") == "Variable" {
+			names[int(stmt.GetInt64("p1"))] = strings.TrimLeft(stmt.GetText("p4"), ":@$")
+		}
+		return nil
+	})
+	return names, err
+}
+
+// lastSyncDate returns the last trading date recorded in the database for the exchange
+// It returns zero time if nothing is recorded for the exchange.
+func lastSyncDate(c *sqlite.Conn, exchange string) (last time.Time) {
+	var stmt = c.Prep(queries.LastTradingDateByExchange)
+	defer stmt.Reset()
+
+	stmt.SetText(":exchange", exchange)
+	if r, err := stmt.Step(); err != nil {
+		log.Fatal().Err(err).Msg("failed to fetch sync information from database")
+	} else if r {
+		// possible that we don't find any data for the given exchange ..
+		// because maybe we are syncing for the first time for the given exchange
+		last, _ = time.Parse("2006-01-02", stmt.GetText("last_trading_date"))
+	}
+	return last
+}
+
+// exchanges returns the (distinct) exchanges of the registered sources
+func exchanges() []string {
+	var seen = make(map[string]bool)
+	var result []string
+	for _, source := range pipeline.Sources() {
+		if !seen[source.Exchange] {
+			seen[source.Exchange] = true
+			result = append(result, source.Exchange)
 		}
-		*ts, _ = time.Parse("2006-01-02", stmt.GetText("last_trading_date"))
-		_ = stmt.Reset()
 	}
-	return bse, nse
+	return result
 }
 
 func closest(to time.Time, values ...time.Time) time.Time {
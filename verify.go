@@ -0,0 +1,254 @@
+package main
+
+import (
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"embed"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"go.riyazali.net/bhav/pipeline"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//go:embed queries/verify/*.sql
+var verifyQueries embed.FS // data quality checks; each query returns the rows violating the check
+
+// Violation is a row (or a set of rows) that fails a data quality check
+type Violation struct {
+	Exchange    string `json:"exchange"`
+	TradingDate string `json:"trading_date"`
+	Ticker      string `json:"ticker,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Detail      string `json:"detail,omitempty"`
+}
+
+// CheckResult is the outcome of a single data quality check
+type CheckResult struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Count       int         `json:"count"`      // total number of violations
+	Violations  []Violation `json:"violations"` // sample of violations (see --limit)
+}
+
+// Report is the outcome of running all data quality checks against the database
+type Report struct {
+	Database    string        `json:"database"`
+	GeneratedAt time.Time     `json:"generated_at"`
+	Since       string        `json:"since"`
+	Passed      bool          `json:"passed"`
+	Checks      []CheckResult `json:"checks"`
+}
+
+// add adds the result of a check to the report
+func (r *Report) add(result CheckResult) {
+	if result.Violations == nil {
+		result.Violations = []Violation{} // render as an empty list in the report
+	}
+	r.Checks, r.Passed = append(r.Checks, result), r.Passed && result.Count == 0
+	log.Debug().Str("check", result.Name).Int("count", result.Count).Msg("completed check")
+}
+
+// verifyOptions configures the data quality checks
+type verifyOptions struct {
+	since   time.Time // only check rows on / after this date
+	maxJump float64   // maximum change (in percent) in close price between consecutive trading days
+	limit   int       // maximum number of violations to report per check
+}
+
+// verifyDatabase runs all data quality checks against the database
+func verifyDatabase(c *sqlite.Conn, opts verifyOptions) (*Report, error) {
+	var report = &Report{Database: filename, GeneratedAt: time.Now(), Since: opts.since.Format("2006-01-02"), Passed: true}
+
+	var params = map[string]interface{}{"since": report.Since, "max_jump": opts.maxJump}
+	var results, err = runChecks(c, verifyQueries, "queries/verify/*.sql", params, opts.limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		report.add(result)
+	}
+
+	var missing = CheckResult{Name: "missing_trading_days", Description: "expected trading days (per exchange calendar) with no data"}
+	for _, source := range pipeline.Sources() {
+		var days, err = missingTradingDays(c, source, opts.since)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, day := range days {
+			if missing.Count++; missing.Count <= opts.limit {
+				missing.Violations = append(missing.Violations, Violation{Exchange: source.Exchange, TradingDate: day.Format("2006-01-02")})
+			}
+		}
+	}
+	report.add(missing)
+
+	return report, nil
+}
+
+// runChecks runs the checks (queries) matching pattern in the given file system. Each query must return
+// the rows violating the check with exchange, trading_date, ticker, type and detail columns, and can use any
+// of the named parameters (as :name) in params. The first line of the query (a comment) describes the check.
+func runChecks(c *sqlite.Conn, queries fs.FS, pattern string, params map[string]interface{}, limit int) (_ []CheckResult, err error) {
+	var results []CheckResult
+
+	var files, _ = fs.Glob(queries, pattern)
+	for _, file := range files {
+		var query, _ = fs.ReadFile(queries, file)
+		var result = CheckResult{
+			Name:        strings.TrimSuffix(filepath.Base(file), ".sql"),
+			Description: strings.TrimSpace(strings.TrimPrefix(strings.SplitN(string(query), "\n", 2)[0], "--")),
+		}
+
+		var names map[int]string
+		if names, err = paramNames(c, string(query)); err != nil {
+			return nil, errors.Wrapf(err, "failed to prepare check %s", result.Name)
+		}
+
+		var stmt = c.Prep(string(query))
+		for i := 1; i <= stmt.BindParamCount(); i++ {
+			switch v := params[names[i]].(type) {
+			case float64:
+				stmt.BindFloat(i, v)
+			case string:
+				stmt.BindText(i, v)
+			}
+		}
+
+		for {
+			var hasRow bool
+			if hasRow, err = stmt.Step(); err != nil {
+				_ = stmt.Reset()
+				return nil, errors.Wrapf(err, "failed to run check %s", result.Name)
+			} else if !hasRow {
+				break
+			}
+
+			if result.Count++; result.Count <= limit {
+				result.Violations = append(result.Violations, Violation{
+					Exchange:    stmt.GetText("exchange"),
+					TradingDate: stmt.GetText("trading_date"),
+					Ticker:      stmt.GetText("ticker"),
+					Type:        stmt.GetText("type"),
+					Detail:      stmt.GetText("detail"),
+				})
+			}
+		}
+		_ = stmt.Reset()
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// missingTradingDays returns the trading days (i.e. days which aren't a holiday in the source's calendar) on / after
+// since and within the range of data recorded for the source's exchange, for which the database has no data
+func missingTradingDays(c *sqlite.Conn, source *pipeline.Source, since time.Time) (_ []time.Time, err error) {
+	var exchange = source.Exchange
+
+	var recorded = make(map[string]bool)
+	var first, last string
+
+	const query = "SELECT DISTINCT trading_date FROM equity WHERE exchange = ? ORDER BY trading_date"
+	err = sqlitex.Exec(c, query, func(stmt *sqlite.Stmt) error {
+		var d = stmt.GetText("trading_date")
+		if first == "" {
+			first = d
+		}
+		recorded[d], last = true, d
+		return nil
+	}, exchange)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch trading dates for %s", exchange)
+	}
+
+	if first == "" { // nothing recorded for the exchange
+		return nil, nil
+	}
+
+	var start, _ = time.Parse("2006-01-02", first)
+	var end, _ = time.Parse("2006-01-02", last)
+	if since.After(start) {
+		start = since
+	}
+
+	var missing []time.Time
+	for d := start; !d.After(end); d = d.Add(day) {
+		if !source.Holiday(d) && !recorded[d.Format("2006-01-02")] {
+			missing = append(missing, d)
+		}
+	}
+	return missing, nil
+}
+
+// writeReport writes the report as json to the named file, or to stdout if name is "-"
+func writeReport(report *Report, name string) (err error) {
+	var w io.Writer = os.Stdout
+	if name != "-" {
+		var file *os.File
+		if file, err = os.Create(name); err != nil {
+			return errors.Wrapf(err, "failed to create %s", name)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	var encoder = json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// logReport logs a summary of the report
+func logReport(report *Report) {
+	for _, check := range report.Checks {
+		if check.Count > 0 {
+			log.Warn().Str("check", check.Name).Int("count", check.Count).Msg(check.Description)
+		}
+	}
+
+	if report.Passed {
+		log.Info().Msg("all data quality checks passed")
+	}
+}
+
+// verify implements the `verify` command which runs data quality checks against the database
+// and writes a machine-readable (json) report. It exits with a non-zero status if any check fails.
+func verify(args []string) {
+	var opts = verifyOptions{}
+	var since date
+	var output string
+
+	var flags = newFlagSet("verify")
+	flags.Var(&since, "since", "only check data on / after this date")
+	flags.Float64Var(&opts.maxJump, "max-jump", 20, "maximum change (in percent) in close price between consecutive trading days")
+	flags.IntVar(&opts.limit, "limit", 100, "maximum number of violations to report per check")
+	flags.StringVar(&output, "output", "-", "file to write the report to (- for stdout)")
+	_ = flags.Parse(args)
+	configureLogging()
+
+	var conn = openDatabase(filename)
+	defer conn.Close()
+
+	opts.since = time.Time(since)
+	var report, err = verifyDatabase(conn, opts)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to verify database")
+	}
+
+	if err = writeReport(report, output); err != nil {
+		log.Fatal().Err(err).Msg("failed to write report")
+	}
+
+	logReport(report)
+	if !report.Passed {
+		_ = conn.Close()
+		os.Exit(1)
+	}
+}
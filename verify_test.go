@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crawshaw.io/sqlite/sqlitex"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	var conn = openDatabase(filepath.Join(t.TempDir(), "bhavcopy.db"))
+	defer conn.Close()
+
+	// nse is missing 2021-01-28 and 2021-02-10 (trading days); 2021-01-26 (republic day) and weekends are holidays
+	var script string
+	for _, d := range []string{"2021-01-25", "2021-01-27", "2021-01-29", "2021-02-01", "2021-02-02", "2021-02-03",
+		"2021-02-04", "2021-02-05", "2021-02-08", "2021-02-09", "2021-02-11", "2021-02-12"} {
+		script += fmt.Sprintf("INSERT INTO equity (exchange, trading_date, ticker, type, open, high, low, close) "+
+			"VALUES ('nse', '%s', 'INFY', 'EQ', 100, 110, 90, 105);\n", d)
+	}
+	script += "INSERT INTO equity (exchange, trading_date, ticker, type, open, high, low, close) " +
+		"VALUES ('bse', '2021-01-25', 'INFY', 'A', 100, 110, 90, 120);" // close above high
+	if err := sqlitex.ExecScript(conn, script); err != nil {
+		t.Fatal(err)
+	}
+
+	var since = time.Date(2021, 01, 01, 0, 0, 0, 0, time.UTC)
+	var report, err = verifyDatabase(conn, verifyOptions{since: since, maxJump: 20, limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Passed {
+		t.Errorf("expected the report to fail")
+	}
+
+	var checks = make(map[string]CheckResult)
+	for _, check := range report.Checks {
+		checks[check.Name] = check
+	}
+
+	if ohlc := checks["ohlc_consistency"]; ohlc.Count != 1 || ohlc.Violations[0].Exchange != "bse" {
+		t.Errorf("expected a single ohlc violation on bse; got %+v", ohlc)
+	}
+
+	var missing []string
+	for _, v := range checks["missing_trading_days"].Violations {
+		missing = append(missing, v.Exchange+" "+v.TradingDate)
+	}
+	if want := []string{"nse 2021-01-28", "nse 2021-02-10"}; fmt.Sprint(missing) != fmt.Sprint(want) {
+		t.Errorf("expected missing trading days %v; got %v", want, missing)
+	}
+}